@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/crypto"
+	"github.com/typhoon51280/jwe-tool/ioutil"
+)
+
+var batchSource = flag.String("batch", "", "sign|encrypt|verify|decrypt many inputs: newline-delimited file, - for stdin, directory or glob")
+var batchWorkers = flag.Int("workers", runtime.NumCPU(), "batch: number of concurrent workers")
+
+type batchItem struct {
+	Index  int
+	Source string
+	Input  string
+}
+
+type batchResult struct {
+	Index        int                  `json:"index"`
+	Source       string               `json:"source"`
+	OK           bool                 `json:"ok"`
+	Token        string               `json:"token,omitempty"`
+	Claims       interface{}          `json:"claims,omitempty"`
+	Plaintext    string               `json:"plaintext,omitempty"`
+	Layers       []crypto.Layer       `json:"layers,omitempty"`
+	Verification *crypto.VerifyResult `json:"verification,omitempty"`
+	Error        string               `json:"error,omitempty"`
+}
+
+func batch() {
+
+	if *batchWorkers < 1 {
+		log.Fatal().Msgf("Invalid parameter -workers %d", *batchWorkers)
+	}
+	process := batchProcessor()
+
+	var out io.Writer = os.Stdout
+	if len(*outFile) > 0 && *outFile != ioutil.Stdio {
+		file, err := ioutil.CreateSecretFile(*outFile)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Unable to write file %v", *outFile)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	log.Info().Msgf("Start batch %s with %d workers ...", *flgOp, *batchWorkers)
+
+	items := make(chan batchItem)
+	results := make(chan batchResult)
+	var readErr error
+	go func() {
+		defer close(items)
+		readErr = readBatchItems(*batchSource, items)
+	}()
+	var workers sync.WaitGroup
+	for i := 0; i < *batchWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for item := range items {
+				result := batchResult{Index: item.Index, Source: item.Source}
+				if err := process(item.Input, &result); err != nil {
+					result.Error = err.Error()
+				} else {
+					result.OK = true
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	encoder := json.NewEncoder(out)
+	pending := map[int]batchResult{}
+	next, failed := 0, 0
+	for result := range results {
+		pending[result.Index] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if !ready.OK {
+				failed++
+				log.Warn().Msgf("Item %d [%s] failed: %s", ready.Index, ready.Source, ready.Error)
+			}
+			if err := encoder.Encode(ready); err != nil {
+				log.Fatal().Err(err).Msg("Unable to write batch result")
+			}
+			next++
+		}
+	}
+	if readErr != nil {
+		log.Fatal().Err(readErr).Msgf("Error reading batch %s after %d items", *batchSource, next)
+	}
+
+	if failed > 0 {
+		log.Error().Msgf("Batch completed: %d items, %d failed", next, failed)
+		os.Exit(1)
+	}
+	log.Info().Msgf("Batch completed: %d items", next)
+	log.Info().Msg("DONE 😀")
+
+}
+
+func batchProcessor() func(input string, result *batchResult) error {
+	switch *flgOp {
+	case "sign":
+		if !hasSignKey(true) {
+			log.Fatal().Msg("Missing parameter: -sig or -sig-secret")
+		}
+		sigPrivateKey, sigPublicKey := loadSignKey(true)
+		signOptions := createSignOptions(sigPrivateKey, sigPublicKey)
+		payload := batchPayload(true)
+		return func(input string, result *batchResult) error {
+			claims, err := payload(input)
+			if err != nil {
+				return err
+			}
+			result.Token, _, err = crypto.Sign(claims, signOptions)
+			return err
+		}
+	case "encrypt":
+		if !hasEncryptKey() {
+			log.Fatal().Msg("Missing parameter: -enc, -enc-secret or -enc-passphrase")
+		}
+		encOptions := createEncOptions(loadEncryptKeys(false))
+		signOptions := crypto.SignOptions{}
+		if *nesting != crypto.NestingEncrypt {
+			if !hasSignKey(true) {
+				log.Fatal().Msg("Missing parameter: -sig or -sig-secret")
+			}
+			sigPrivateKey, sigPublicKey := loadSignKey(true)
+			signOptions = createSignOptions(sigPrivateKey, sigPublicKey)
+		}
+		payload := batchPayload(hasClaimFlags() || *nesting == crypto.NestingSignEncrypt)
+		return func(input string, result *batchResult) error {
+			plaintext, err := payload(input)
+			if err != nil {
+				return err
+			}
+			result.Token, _, err = crypto.Encode(plaintext, encOptions, signOptions)
+			return err
+		}
+	case "verify":
+		if !hasSignKey(false) {
+			log.Fatal().Msg("Missing parameter: -sig, -sig-secret, -issuer or -x5c")
+		}
+		_, sigPublicKey := loadSignKey(false)
+		signOptions := createSignOptions(nil, sigPublicKey)
+		return func(input string, result *batchResult) error {
+			verification, err := crypto.Verify(input, signOptions)
+			if verification != nil {
+				result.Verification = verification
+				result.Claims = verification.Token.Claims
+			}
+			return err
+		}
+	case "decrypt":
+		if !hasEncryptKey() {
+			log.Fatal().Msg("Missing parameter: -enc, -enc-secret or -enc-passphrase")
+		}
+		encOptions := createEncOptions(loadEncryptKeys(true))
+		signOptions := crypto.SignOptions{Validation: createValidationOptions(), Critical: criticalNames.Values()}
+		if hasSignKey(false) {
+			_, sigPublicKey := loadSignKey(false)
+			signOptions = createSignOptions(nil, sigPublicKey)
+		}
+		return func(input string, result *batchResult) error {
+			decoded, err := crypto.Decode(input, encOptions, signOptions)
+			if decoded == nil {
+				return err
+			}
+			result.Layers = decoded.Layers
+			result.Verification = decoded.Verification
+			if decoded.Verification != nil {
+				result.Claims = decoded.Verification.Token.Claims
+			} else {
+				result.Plaintext = decoded.Plaintext
+			}
+			return err
+		}
+	}
+	log.Fatal().Msgf("Parameter -batch supports sign|encrypt|verify|decrypt, found -command %s", *flgOp)
+	return nil
+}
+
+func batchPayload(claims bool) func(input string) (string, error) {
+	if !claims {
+		return func(input string) (string, error) {
+			return input, nil
+		}
+	}
+	claimsOptions := createClaimsOptions()
+	if !isTemplate() {
+		return func(input string) (string, error) {
+			return crypto.BuildClaims([]byte(input), claimsOptions)
+		}
+	}
+	if len(*inFile) == 0 {
+		log.Fatal().Msg("Claims template requires -in")
+	}
+	template := ioutil.LoadInput(*inFile)
+	templateOptions := createTemplateOptions()
+	return func(input string) (string, error) {
+		decoded, err := decodeJSON([]byte(input))
+		if err != nil {
+			return "", fmt.Errorf("template variables: %w", err)
+		}
+		object, ok := decoded.(map[string]interface{})
+		if !ok {
+			return "", errors.New("template variables must be a JSON object")
+		}
+		options := crypto.TemplateOptions{Now: templateOptions.Now, Variables: map[string]interface{}{}}
+		for name, value := range templateOptions.Variables {
+			options.Variables[name] = value
+		}
+		for name, value := range object {
+			options.Variables[name] = value
+		}
+		rendered, err := crypto.RenderTemplate(*inFile, template, options)
+		if err != nil {
+			return "", err
+		}
+		return crypto.BuildClaims(rendered, claimsOptions)
+	}
+}
+
+func readBatchItems(source string, items chan<- batchItem) error {
+	if source == "-" {
+		stdin, err := ioutil.OpenStdin()
+		if err != nil {
+			return err
+		}
+		return readBatchLines("stdin", stdin, items)
+	}
+	info, err := os.Stat(source)
+	var paths []string
+	switch {
+	case err == nil && info.IsDir():
+		entries, err := os.ReadDir(source)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				paths = append(paths, filepath.Join(source, entry.Name()))
+			}
+		}
+	case err == nil:
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return readBatchLines(source, file, items)
+	default:
+		if paths, err = filepath.Glob(source); err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("no input matches %s", source)
+		}
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		items <- batchItem{Index: i, Source: path, Input: strings.TrimSpace(string(data))}
+	}
+	return nil
+}
+
+func readBatchLines(name string, reader io.Reader, items chan<- batchItem) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	index, line := 0, 0
+	for scanner.Scan() {
+		line++
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+		items <- batchItem{Index: index, Source: fmt.Sprintf("%s:%d", name, line), Input: input}
+		index++
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	stdcrypto "crypto"
+	"flag"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/ioutil"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+var mergeFiles = newStringList("merge", "convert: additional key file merged with -in, repeatable")
+var publicOnly = flag.Bool("public", false, "convert: write only the public half of the keys")
+var keyOps = newStringList("key-ops", "convert key operations (key_ops), repeatable: sign|verify|encrypt|decrypt|wrapKey|unwrapKey|deriveKey|deriveBits")
+var stripFields = newStringList("strip", "convert: remove a key member, repeatable: kid|use|alg|key_ops|x5c")
+var derOutput = flag.Bool("der", false, "convert: write DER instead of PEM (requires -out)")
+
+func convert() {
+
+	log.Info().Msg("Start converting key ...")
+	if len(*inFile) == 0 {
+		log.Fatal().Msg("Missing parameter: -in")
+	}
+	var pairs []key.JWKeyPair
+	for _, path := range append([]string{*inFile}, mergeFiles.Values()...) {
+		pairs = append(pairs, loadKeySet(path, ioutil.LoadInput(path)).Keys...)
+	}
+	if len(*kid) > 0 && len(pairs) > 1 {
+		log.Fatal().Msgf("Parameter -kid applies to a single key, found %d keys, use -kid-thumbprint", len(pairs))
+	}
+
+	private := false
+	for i := range pairs {
+		pair := &pairs[i]
+		if *publicOnly {
+			if _, symmetric := pair.PublicKey.([]byte); symmetric {
+				log.Fatal().Msgf("Key %d [%s] is symmetric and has no public half", i, pair.KeyID)
+			}
+			pair.PrivateKey = nil
+		}
+		private = private || pair.PrivateKey != nil
+		for _, field := range stripFields.Values() {
+			switch field {
+			case "kid":
+				pair.KeyID = ""
+			case "use":
+				pair.Use = ""
+			case "alg":
+				pair.Algorithm = ""
+			case "key_ops":
+				pair.KeyOps = nil
+			case "x5c":
+				pair.Certificates = nil
+			default:
+				log.Fatal().Msgf("Invalid parameter -strip %s, use kid|use|alg|key_ops|x5c", field)
+			}
+		}
+		thumbprint, err := key.Thumbprint(pair.PublicKey, stdcrypto.SHA256)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error computing thumbprint of key %d", i)
+		}
+		if len(*kid) > 0 {
+			pair.KeyID = *kid
+		}
+		if *kidThumbprint {
+			pair.KeyID = thumbprint
+		}
+		if len(*keyUse) > 0 {
+			pair.Use = *keyUse
+		}
+		if len(*keyAlgorithm) > 0 {
+			pair.Algorithm = *keyAlgorithm
+		}
+		if len(keyOps.Values()) > 0 {
+			pair.KeyOps = keyOps.Values()
+		}
+		log.Info().Msgf("Key %d [%s] %T, thumbprint (RFC 7638 SHA-256): %s", i, pair.KeyID, pair.PublicKey, thumbprint)
+	}
+
+	var data []byte
+	var err error
+	if *derOutput {
+		if len(*outFile) == 0 || *outFile == ioutil.Stdio {
+			log.Fatal().Msg("Parameter -der requires an -out file")
+		}
+		if len(pairs) != 1 {
+			log.Fatal().Msgf("DER holds a single key, found %d keys", len(pairs))
+		}
+		data, err = key.MarshalDER(pairs[0], *keyFormat)
+	} else {
+		data, err = key.MarshalKeyPairs(pairs, *keyFormat)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Error encoding key as %s", *keyFormat)
+	}
+
+	if len(*outFile) == 0 && !private {
+		log.Info().Msgf("Key |-\n%s", ioutil.PrintText("Key", strings.TrimSuffix(string(data), "\n"), color.BgCyan, color.FgWhite, color.Bold))
+	}
+	writeOutput(string(data), private)
+
+	log.Info().Msg("DONE 😀")
+
+}
+
+func loadKeySet(path string, keyBytes []byte) *key.KeySet {
+	keySet, err := key.LoadKeySet(keyBytes, createLoadOptions("input", ""))
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Error loading key %v (shared secrets need an oct JWK)", path)
+	}
+	return keySet
+}
@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+var contentEncryptionKeySize = map[jose.ContentEncryption]int{
+	jose.A128GCM:       16,
+	jose.A192GCM:       24,
+	jose.A256GCM:       32,
+	jose.A128CBC_HS256: 32,
+	jose.A192CBC_HS384: 48,
+	jose.A256CBC_HS512: 64,
+}
+
+var keyWrapSize = map[jose.KeyAlgorithm]int{
+	jose.A128KW:    16,
+	jose.A192KW:    24,
+	jose.A256KW:    32,
+	jose.A128GCMKW: 16,
+	jose.A192GCMKW: 24,
+	jose.A256GCMKW: 32,
+}
+
+var passwordAlgorithms = []jose.KeyAlgorithm{
+	jose.PBES2_HS256_A128KW,
+	jose.PBES2_HS384_A192KW,
+	jose.PBES2_HS512_A256KW,
+}
+
+var signingAlgorithms = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+func SigningAlgorithms(k interface{}) []string {
+	var algs []string
+	for _, alg := range signingAlgorithms {
+		if key.Compatible(k, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+func EncryptionAlgorithms(k interface{}) []string {
+	var algs []string
+	if secret, ok := k.([]byte); ok {
+		for _, size := range contentEncryptionKeySize {
+			if size == len(secret) {
+				algs = append(algs, string(jose.DIRECT))
+				break
+			}
+		}
+	}
+	for _, alg := range KeyAlgorithms(k, "") {
+		algs = append(algs, string(alg))
+	}
+	return algs
+}
+
+func IsSymmetricKeyAlgorithm(alg string) bool {
+	switch jose.KeyAlgorithm(alg) {
+	case jose.DIRECT, jose.PBES2_HS256_A128KW, jose.PBES2_HS384_A192KW, jose.PBES2_HS512_A256KW:
+		return true
+	}
+	_, ok := keyWrapSize[jose.KeyAlgorithm(alg)]
+	return ok
+}
+
+func KeyAlgorithms(key interface{}, enc jose.ContentEncryption) []jose.KeyAlgorithm {
+	switch k := key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return []jose.KeyAlgorithm{jose.RSA1_5, jose.RSA_OAEP, jose.RSA_OAEP_256}
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return []jose.KeyAlgorithm{jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW}
+	case []byte:
+		var algs []jose.KeyAlgorithm
+		if size, ok := contentEncryptionKeySize[enc]; ok && size == len(k) {
+			algs = append(algs, jose.DIRECT)
+		}
+		for _, alg := range []jose.KeyAlgorithm{jose.A128KW, jose.A192KW, jose.A256KW, jose.A128GCMKW, jose.A192GCMKW, jose.A256GCMKW} {
+			if keyWrapSize[alg] == len(k) {
+				algs = append(algs, alg)
+			}
+		}
+		return append(algs, passwordAlgorithms...)
+	}
+	return nil
+}
+
+func defaultKeyAlgorithm(key interface{}) jose.KeyAlgorithm {
+	switch k := key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return jose.RSA_OAEP
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return jose.ECDH_ES_A256KW
+	case []byte:
+		for _, alg := range []jose.KeyAlgorithm{jose.A128KW, jose.A192KW, jose.A256KW} {
+			if keyWrapSize[alg] == len(k) {
+				return alg
+			}
+		}
+	}
+	return ""
+}
+
+func validateKeyAlgorithm(alg jose.KeyAlgorithm, enc jose.ContentEncryption, key interface{}) error {
+	algs := KeyAlgorithms(key, enc)
+	names := make([]string, len(algs))
+	for i, a := range algs {
+		if a == alg {
+			return nil
+		}
+		names[i] = string(a)
+	}
+	if len(algs) == 0 {
+		return fmt.Errorf("key type %T cannot be used for encryption", key)
+	}
+	return fmt.Errorf("algorithm [%s] not compatible with key %s, use one of %s", alg, describeKey(key), strings.Join(names, "|"))
+}
+
+func describeKey(value interface{}) string {
+	switch k := value.(type) {
+	case nil:
+		return "none"
+	case *key.KeySet:
+		return fmt.Sprintf("JWKS %d keys", k.Len())
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", k.N.BitLen())
+	case *rsa.PrivateKey:
+		return fmt.Sprintf("RSA %d bits", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("EC %s", k.Curve.Params().Name)
+	case *ecdsa.PrivateKey:
+		return fmt.Sprintf("EC %s", k.Curve.Params().Name)
+	case []byte:
+		return fmt.Sprintf("oct %d bits", len(k)*8)
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+func selectVerifyKeys(signOptions SignOptions, hint key.KeyHint, x5c []*x509.Certificate, claims jwt.MapClaims) ([]key.JWKeyPair, error) {
+	var candidates []key.JWKeyPair
+	if signOptions.PublicKey != nil {
+		var err error
+		if candidates, err = key.SelectKeys(signOptions.PublicKey, true, signOptions.Kid, hint); err != nil {
+			return nil, wrapError(ErrKeyNotFound, err)
+		}
+	}
+	trust := signOptions.Trust
+	if trust == nil {
+		if len(candidates) == 0 {
+			return nil, wrapError(ErrKeyNotFound, errors.New("no verification key"))
+		}
+		return candidates, nil
+	}
+	if len(x5c) > 0 {
+		if trust.AllowX5C {
+			log.Debug().Msgf("Using x5c certificate [%s] from token header", x5c[0].Subject)
+			candidates = append([]key.JWKeyPair{key.CertificateKeyPair(x5c)}, candidates...)
+		} else {
+			log.Warn().Msg("Token x5c header ignored, accepting it requires -x5c")
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, wrapError(ErrKeyNotFound, errors.New("no verification key and no trusted x5c header"))
+	}
+
+	at := signOptions.Validation.now()
+	if iat, ok, err := timeClaim(claims, "iat"); ok && err == nil {
+		at = iat
+	}
+	var trusted []key.JWKeyPair
+	var failures []string
+	for i, candidate := range candidates {
+		if len(candidate.Certificates) == 0 {
+			trusted = append(trusted, candidate)
+			continue
+		}
+		if err := trust.VerifyChain(candidate.Certificates, at); err != nil {
+			log.Debug().Err(err).Msgf("Certificate of key %d rejected", i)
+			failures = append(failures, fmt.Sprintf("key %d: %v", i, err))
+			continue
+		}
+		trusted = append(trusted, candidate)
+	}
+	if len(trusted) == 0 {
+		return nil, wrapError(ErrSignatureInvalid, errors.New(strings.Join(failures, "; ")))
+	}
+	return trusted, nil
+}
+
+func headerCertificates(payload string) ([]*x509.Certificate, error) {
+	trimmed := strings.TrimSpace(payload)
+	var header map[string]interface{}
+	if strings.HasPrefix(trimmed, "{") {
+		var raw jsonSerialization
+		if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+			return nil, err
+		}
+		if len(raw.Signatures) > 0 {
+			raw.Protected, raw.Header = raw.Signatures[0].Protected, raw.Signatures[0].Header
+		}
+		header = raw.Header
+		if raw.Protected != "" {
+			protected, err := decodeHeader(raw.Protected)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := protected["x5c"]; ok || header == nil {
+				header = protected
+			}
+		}
+	} else {
+		protected, err := decodeHeader(strings.SplitN(trimmed, ".", 2)[0])
+		if err != nil {
+			return nil, err
+		}
+		header = protected
+	}
+	values, ok := header["x5c"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return key.ParseCertificateChain(values)
+}
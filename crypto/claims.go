@@ -0,0 +1,155 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/log"
+	"go.step.sm/crypto/randutil"
+)
+
+type ClaimsOptions struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Claims   map[string]interface{}
+}
+
+type TimeClaimsOptions struct {
+	Preserve   bool
+	IssuedAt   string
+	NotBefore  string
+	NoExpiry   bool
+	GenerateID bool
+}
+
+func stampClaims(claims jwt.MapClaims, duration string, options TimeClaimsOptions) error {
+	now := time.Now()
+	if options.IssuedAt != "" {
+		issuedAt, err := ParseTime(options.IssuedAt)
+		if err != nil {
+			return fmt.Errorf("issued at %s not valid: %w", options.IssuedAt, err)
+		}
+		now = issuedAt
+	} else if options.Preserve {
+		if issuedAt, ok, err := timeClaim(claims, "iat"); ok && err == nil {
+			now = issuedAt
+		}
+	}
+	var notBefore time.Duration
+	if options.NotBefore != "" {
+		var err error
+		if notBefore, err = time.ParseDuration(options.NotBefore); err != nil {
+			return fmt.Errorf("not before offset %s not valid: %w", options.NotBefore, err)
+		}
+	}
+	var expiry time.Duration
+	if !options.NoExpiry {
+		var err error
+		if expiry, err = time.ParseDuration(duration); err != nil {
+			return fmt.Errorf("token duration %s not valid: %w", duration, err)
+		}
+	}
+
+	stamp := func(name string, value time.Time) {
+		if _, ok := claims[name]; ok && options.Preserve {
+			log.Debug().Msgf("Preserving claim %s from payload", name)
+			return
+		}
+		claims[name] = value.Unix()
+	}
+	stamp("iat", now)
+	stamp("nbf", now.Add(notBefore))
+	if options.NoExpiry {
+		if _, ok := claims["exp"]; ok && !options.Preserve {
+			delete(claims, "exp")
+		}
+	} else {
+		stamp("exp", now.Add(expiry))
+	}
+	if _, ok := claims["jti"]; !ok && options.GenerateID {
+		jti, err := randutil.UUIDv4()
+		if err != nil {
+			return fmt.Errorf("generating jti: %w", err)
+		}
+		claims["jti"] = jti
+	}
+	return nil
+}
+
+func BuildClaims(template []byte, options ClaimsOptions) (string, error) {
+	claims := map[string]interface{}{}
+	if len(bytes.TrimSpace(template)) > 0 {
+		var err error
+		if claims, err = decodeClaims(template); err != nil {
+			return "", wrapError(ErrInvalidPayload, err)
+		}
+	}
+	if options.Issuer != "" {
+		claims["iss"] = options.Issuer
+	}
+	if options.Subject != "" {
+		claims["sub"] = options.Subject
+	}
+	switch len(options.Audience) {
+	case 0:
+	case 1:
+		claims["aud"] = options.Audience[0]
+	default:
+		claims["aud"] = options.Audience
+	}
+	for name, value := range options.Claims {
+		claims[name] = value
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", wrapError(ErrInvalidPayload, err)
+	}
+	return string(data), nil
+}
+
+func decodeClaims(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var claims map[string]interface{}
+	if err := decoder.Decode(&claims); err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxError):
+			line, column := position(data, syntaxError.Offset-1)
+			return nil, fmt.Errorf("malformed JSON at line %d, column %d: %v", line, column, err)
+		case errors.As(err, &typeError):
+			return nil, fmt.Errorf("claims must be a JSON object, found %s", typeError.Value)
+		}
+		return nil, fmt.Errorf("malformed JSON: %w", err)
+	}
+	if claims == nil {
+		return nil, errors.New("claims must be a JSON object, found null")
+	}
+	offset := decoder.InputOffset()
+	if _, err := decoder.Token(); err != io.EOF {
+		rest := data[offset:]
+		line, column := position(data, offset+int64(len(rest)-len(bytes.TrimLeft(rest, " \t\r\n"))))
+		return nil, fmt.Errorf("malformed JSON at line %d, column %d: unexpected data after the claims object", line, column)
+	}
+	return claims, nil
+}
+
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeClaimsTrailingData(t *testing.T) {
+	for _, test := range []struct {
+		data  string
+		error string
+	}{
+		{`{"a":1}`, ""},
+		{"{\"a\":1}\n  \n", ""},
+		{`{"a":1}}`, "line 1, column 8: unexpected data after the claims object"},
+		{`{"a":1}]`, "line 1, column 8: unexpected data after the claims object"},
+		{"{\"a\":1}\n {\"b\":2}", "line 2, column 2: unexpected data after the claims object"},
+		{`{"a":1} x`, "line 1, column 9: unexpected data after the claims object"},
+	} {
+		claims, err := decodeClaims([]byte(test.data))
+		if test.error == "" {
+			if err != nil || claims["a"] == nil {
+				t.Errorf("decodeClaims(%q) = %v, %v", test.data, claims, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("decodeClaims(%q) error = %v, want %q", test.data, err, test.error)
+		}
+	}
+}
@@ -1,72 +1,445 @@
 package crypto
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/go-jose/go-jose/v3"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+const (
+	NestingSignEncrypt = "sign-encrypt"
+	NestingEncryptSign = "encrypt-sign"
+	NestingEncrypt     = "encrypt"
 )
 
+const maxNestingDepth = 8
+
+const (
+	SerializationCompact   = "compact"
+	SerializationJSON      = "json"
+	SerializationFlattened = "flattened"
+)
+
+type Recipient struct {
+	Algorithm string
+	KeyID     string
+	Key       interface{}
+	fromSet   bool
+	keyPair   key.JWKeyPair
+}
+
 type EncodeOptions struct {
-	Algorithm  string
-	Encoding   string
-	PrivateKey interface{}
-	PublicKey  interface{}
+	Algorithm     string
+	Encoding      string
+	PrivateKey    interface{}
+	PublicKey     interface{}
+	Recipients    []Recipient
+	Serialization string
+	Nesting       string
+	KeyHeaders    KeyHeaders
+	Headers       map[string]interface{}
+	Critical      []string
 }
 
-func Encode(payload string, encodeOptions EncodeOptions, signOptions SignOptions) (string, jwt.Token) {
+type Layer struct {
+	Type           string `json:"type"`
+	Algorithm      string `json:"alg"`
+	Encoding       string `json:"enc,omitempty"`
+	ContentType    string `json:"cty,omitempty"`
+	Recipient      int    `json:"recipient"`
+	RecipientKeyID string `json:"recipient_kid,omitempty"`
+	Key            int    `json:"key"`
+	KeyID          string `json:"kid,omitempty"`
+	SignatureValid bool   `json:"signature_valid,omitempty"`
+}
 
-	log.Debug().Msgf("Encode with options: %+v", encodeOptions)
+type DecodeResult struct {
+	Plaintext    string        `json:"-"`
+	Layers       []Layer       `json:"layers"`
+	Verification *VerifyResult `json:"verification,omitempty"`
+}
+
+func (o EncodeOptions) recipients(pub bool) []Recipient {
+	recipients := o.Recipients
+	if len(recipients) == 0 {
+		k := o.PublicKey
+		if !pub {
+			k = o.PrivateKey
+		}
+		recipients = []Recipient{{Key: k}}
+	}
+	var expanded []Recipient
+	for _, recipient := range recipients {
+		if recipient.Algorithm == "" {
+			recipient.Algorithm = o.Algorithm
+		}
+		keySet, ok := recipient.Key.(*key.KeySet)
+		if !ok {
+			expanded = append(expanded, recipient)
+			continue
+		}
+		for _, keyPair := range keySet.Keys {
+			if !keyPair.Usable("enc", "") {
+				log.Debug().Msgf("Skipping key [%s] with use [%s]", keyPair.KeyID, keyPair.Use)
+				continue
+			}
+			k := keyPair.PublicKey
+			if !pub {
+				k = keyPair.PrivateKey
+			}
+			expanded = append(expanded, Recipient{Algorithm: recipient.Algorithm, KeyID: keyPair.KeyID, Key: k, fromSet: true, keyPair: keyPair})
+		}
+	}
+	return expanded
+}
 
-	tokenData, token := Sign(payload, signOptions)
+func (o EncodeOptions) String() string {
+	recipients := make([]string, len(o.Recipients))
+	for i, recipient := range o.Recipients {
+		recipients[i] = fmt.Sprintf("{Algorithm:%s KeyID:%s Key:%s}", recipient.Algorithm, recipient.KeyID, describeKey(recipient.Key))
+	}
+	return fmt.Sprintf("{Algorithm:%s Encoding:%s Serialization:%s Nesting:%s Recipients:[%s]}", o.Algorithm, o.Encoding, o.Serialization, o.Nesting, strings.Join(recipients, " "))
+}
 
-	alg := jose.KeyAlgorithm(encodeOptions.Algorithm)
-	enc := jose.ContentEncryption(encodeOptions.Encoding)
-	recpt := jose.Recipient{
-		Algorithm: alg,
-		Key:       encodeOptions.PublicKey,
+func (o EncodeOptions) GoString() string {
+	return o.String()
+}
+
+func Encode(payload string, encodeOptions EncodeOptions, signOptions SignOptions) (string, *jwt.Token, error) {
+
+	log.Debug().Msgf("Encode with options: %v", encodeOptions)
+
+	recipients, err := encodeOptions.joseRecipients()
+	if err != nil {
+		return "", nil, err
 	}
+
+	switch encodeOptions.Nesting {
+	case "", NestingSignEncrypt:
+		tokenData, token, err := Sign(payload, signOptions)
+		if err != nil {
+			return "", nil, err
+		}
+		encodedData, err := encrypt([]byte(tokenData), "JWT", recipients, encodeOptions)
+		if err != nil {
+			return "", token, err
+		}
+		log.Info().Msg("JWT encoded with success")
+		return encodedData, token, nil
+	case NestingEncrypt:
+		contentType := ""
+		if DetectFormat(payload) != "" {
+			contentType = "JWT"
+		}
+		encodedData, err := encrypt([]byte(payload), contentType, recipients, encodeOptions)
+		if err != nil {
+			return "", nil, err
+		}
+		log.Info().Msg("Payload encrypted with success")
+		return encodedData, nil, nil
+	case NestingEncryptSign:
+		encryptedData, err := encrypt([]byte(payload), "", recipients, encodeOptions)
+		if err != nil {
+			return "", nil, err
+		}
+		signedData, err := signNested(encryptedData, signOptions)
+		if err != nil {
+			return "", nil, err
+		}
+		log.Info().Msg("Payload encrypted and signed with success")
+		return signedData, nil, nil
+	}
+	return "", nil, fmt.Errorf("nesting [%s] not supported, use %s|%s|%s", encodeOptions.Nesting,
+		NestingSignEncrypt, NestingEncryptSign, NestingEncrypt)
+}
+
+func (o EncodeOptions) joseRecipients() ([]jose.Recipient, error) {
+	enc := jose.ContentEncryption(o.Encoding)
+	recipients := o.recipients(true)
+	if len(recipients) == 0 {
+		return nil, wrapError(ErrKeyNotFound, errors.New("no recipients"))
+	}
+	joseRecipients := make([]jose.Recipient, len(recipients))
+	for i, recipient := range recipients {
+		alg := jose.KeyAlgorithm(recipient.Algorithm)
+		if recipient.Key == nil {
+			return nil, wrapError(ErrKeyNotFound, fmt.Errorf("recipient %d has no key", i))
+		}
+		if err := validateKeyAlgorithm(alg, enc, recipient.Key); err != nil {
+			if !recipient.fromSet || defaultKeyAlgorithm(recipient.Key) == "" {
+				return nil, wrapError(ErrEncrypt, fmt.Errorf("recipient %d: %w", i, err))
+			}
+			alg = defaultKeyAlgorithm(recipient.Key)
+			log.Info().Msgf("Recipient %d [%s]: algorithm %s used in place of %s", i, recipient.KeyID, alg, recipient.Algorithm)
+		}
+		joseRecipients[i] = jose.Recipient{
+			Algorithm: alg,
+			KeyID:     recipient.KeyID,
+			Key:       recipient.Key,
+		}
+	}
+	return joseRecipients, nil
+}
+
+func (o EncodeOptions) keyHeaders() (map[string]interface{}, error) {
+	if o.KeyHeaders.empty() {
+		return nil, nil
+	}
+	recipients := o.recipients(true)
+	if o.KeyHeaders.perKey() && len(recipients) > 1 {
+		return nil, fmt.Errorf("key headers describe a single key, found %d recipients", len(recipients))
+	}
+	pair := recipients[0].keyPair
+	if !recipients[0].fromSet {
+		pair = key.JWKeyPair{PublicKey: recipients[0].Key}
+	}
+	return o.KeyHeaders.build(pair)
+}
+
+func encrypt(plaintext []byte, contentType string, recipients []jose.Recipient, encodeOptions EncodeOptions) (string, error) {
+	enc := jose.ContentEncryption(encodeOptions.Encoding)
 	encrypterOptions := jose.EncrypterOptions{}
+	if contentType != "" {
+		encrypterOptions.WithContentType(jose.ContentType(contentType))
+	}
+	headers, err := encodeOptions.keyHeaders()
+	if err != nil {
+		return "", wrapError(ErrEncrypt, err)
+	}
+	for name, value := range headers {
+		encrypterOptions.WithHeader(jose.HeaderKey(name), value)
+	}
+	if err := rejectCritical(encodeOptions.Headers); err != nil {
+		return "", wrapError(ErrEncrypt, err)
+	}
+	if err := validateHeaders(encodeOptions.Headers, "alg", "enc"); err != nil {
+		return "", wrapError(ErrEncrypt, err)
+	}
+	if err := withHeaders(encodeOptions.Headers, func(k jose.HeaderKey, v interface{}) { encrypterOptions.WithHeader(k, v) }); err != nil {
+		return "", wrapError(ErrEncrypt, err)
+	}
 
-	crypter, err := jose.NewEncrypter(enc, recpt, &encrypterOptions)
+	var crypter jose.Encrypter
+	if len(recipients) == 1 {
+		crypter, err = jose.NewEncrypter(enc, recipients[0], &encrypterOptions)
+	} else {
+		crypter, err = jose.NewMultiEncrypter(enc, recipients, &encrypterOptions)
+	}
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to instantiate encrypter")
+		return "", wrapError(ErrEncrypt, err)
 	}
-	log.Trace().Msgf("Encrypter created: %+v", crypter)
+	log.Trace().Msgf("Encrypter created for %d recipients", len(recipients))
 
-	obj, err := crypter.Encrypt([]byte(tokenData))
+	obj, err := crypter.Encrypt(plaintext)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to encrypt")
+		return "", wrapError(ErrEncrypt, err)
 	}
 	log.Trace().Msgf("Encrypting completed: %+v", obj.FullSerialize())
 
-	encodedData, err := obj.CompactSerialize()
+	encodedData, err := serializeEncrypted(obj, encodeOptions.Serialization, len(recipients))
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to serialize message")
+		return "", wrapError(ErrEncrypt, err)
 	}
-	log.Info().Msg("JWT encoded with success")
-	return encodedData, token
+	return encodedData, nil
 }
 
-func Decode(payload string, encodeOptions EncodeOptions, signOptions SignOptions) (string, jwt.Token) {
+func serializeEncrypted(obj *jose.JSONWebEncryption, serialization string, recipients int) (string, error) {
+	switch serialization {
+	case "":
+		if recipients > 1 {
+			return obj.FullSerialize(), nil
+		}
+		return obj.CompactSerialize()
+	case SerializationCompact:
+		if recipients > 1 {
+			return "", errors.New("compact serialization supports a single recipient, use json")
+		}
+		return obj.CompactSerialize()
+	case SerializationFlattened:
+		if recipients > 1 {
+			return "", errors.New("flattened serialization supports a single recipient, use json")
+		}
+		return obj.FullSerialize(), nil
+	case SerializationJSON:
+		if recipients > 1 {
+			return obj.FullSerialize(), nil
+		}
+		return generalSerialize(obj.FullSerialize())
+	}
+	return "", fmt.Errorf("serialization [%s] not supported, use %s|%s|%s", serialization,
+		SerializationCompact, SerializationJSON, SerializationFlattened)
+}
 
-	log.Debug().Msgf("Decode with options: %#v", encodeOptions)
+func generalSerialize(flattened string) (string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(flattened), &raw); err != nil {
+		return "", err
+	}
+	recipient := map[string]json.RawMessage{}
+	for _, name := range []string{"header", "encrypted_key"} {
+		if value, ok := raw[name]; ok {
+			recipient[name] = value
+			delete(raw, name)
+		}
+	}
+	recipients, err := json.Marshal([]interface{}{recipient})
+	if err != nil {
+		return "", err
+	}
+	raw["recipients"] = recipients
+	general, err := json.Marshal(raw)
+	return string(general), err
+}
 
+func Decode(payload string, encodeOptions EncodeOptions, signOptions SignOptions) (*DecodeResult, error) {
+
+	log.Debug().Msgf("Decode with options: %v", encodeOptions)
+
+	result := &DecodeResult{}
+	current := strings.TrimSpace(payload)
+	for depth := 0; ; depth++ {
+		if depth >= maxNestingDepth {
+			return result, wrapError(ErrParse, fmt.Errorf("more than %d nested layers", maxNestingDepth))
+		}
+		switch DetectFormat(current) {
+		case FormatJWE:
+			layer, plaintext, err := decryptLayer(current, encodeOptions)
+			if err != nil {
+				return result, err
+			}
+			result.Layers = append(result.Layers, layer)
+			current = plaintext
+			log.Debug().Msgf("Decrypted JWE layer %d with key %d [%s]", depth, layer.Key, layer.KeyID)
+			log.Trace().Msgf("decrypted data: %s", current)
+		case FormatJWS:
+			if isJWT(current) {
+				result.Plaintext = current
+				err := verifyJWT(result, signOptions)
+				if err == nil {
+					log.Info().Msg("JWT decrypted with success")
+				}
+				return result, err
+			}
+			layer, signedPayload, err := verifyLayer(current, signOptions)
+			result.Layers = append(result.Layers, layer)
+			if err != nil {
+				return result, err
+			}
+			current = signedPayload
+		default:
+			if depth == 0 {
+				return nil, wrapError(ErrParse, errors.New("payload is neither a JWE nor a JWS"))
+			}
+			result.Plaintext = current
+			log.Info().Msg("Payload decrypted with success")
+			return result, nil
+		}
+	}
+}
+
+func decryptLayer(payload string, encodeOptions EncodeOptions) (Layer, string, error) {
 	encryptedData, err := jose.ParseEncrypted(payload)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Unable to parse payload: %s", payload)
+		return Layer{}, "", wrapError(ErrParse, err)
+	}
+	if critical, err := checkCritical(extraHeaders(encryptedData.Header), encodeOptions.Critical); err != nil {
+		return Layer{}, "", wrapError(ErrDecrypt, err)
+	} else if len(critical) > 0 {
+		return Layer{}, "", wrapError(ErrDecrypt, fmt.Errorf("critical headers %v are supported on the JWT layer only", critical))
 	}
-	// log.Debug().Msgf("Parsed encrypted data: %#v", encryptedData)
 
-	data, err := encryptedData.Decrypt(encodeOptions.PrivateKey)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("Unable to decrypt message: %s", payload)
+	candidates := encodeOptions.recipients(false)
+	if len(candidates) == 1 && encryptedData.Header.Algorithm != "" {
+		alg := jose.KeyAlgorithm(encryptedData.Header.Algorithm)
+		encHeader, _ := encryptedData.Header.ExtraHeaders[jose.HeaderKey("enc")].(string)
+		if err := validateKeyAlgorithm(alg, jose.ContentEncryption(encHeader), candidates[0].Key); err != nil {
+			return Layer{}, "", wrapError(ErrDecrypt, err)
+		}
+	}
+
+	var failures []string
+	for _, i := range orderCandidates(candidates, encryptedData.Header) {
+		candidate := candidates[i]
+		index, header, data, err := encryptedData.DecryptMulti(candidate.Key)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Decrypt with key %d [%s] failed", i, candidate.KeyID)
+			failures = append(failures, fmt.Sprintf("key %d: %v", i, err))
+			continue
+		}
+		encHeader, _ := header.ExtraHeaders[jose.HeaderKey("enc")].(string)
+		contentType, _ := header.ExtraHeaders[jose.HeaderContentType].(string)
+		return Layer{
+			Type:           FormatJWE,
+			Algorithm:      header.Algorithm,
+			Encoding:       encHeader,
+			ContentType:    contentType,
+			Recipient:      index,
+			RecipientKeyID: header.KeyID,
+			Key:            i,
+			KeyID:          candidate.KeyID,
+		}, string(data), nil
+	}
+	if len(failures) == 0 {
+		return Layer{}, "", wrapError(ErrKeyNotFound, errors.New("no compatible decryption keys"))
 	}
-	decryptedData := string(data)
-	log.Trace().Msgf("decrypted data: %s", decryptedData)
+	return Layer{}, "", wrapError(ErrDecrypt, errors.New(strings.Join(failures, "; ")))
+}
 
-	token := Verify(decryptedData, signOptions)
+func orderCandidates(candidates []Recipient, header jose.Header) []int {
+	hint := keyHint("enc", header.KeyID, header.Algorithm, header.ExtraHeaders["x5t"], header.ExtraHeaders["x5t#S256"])
+	var matching, others []int
+	for i, candidate := range candidates {
+		if len(candidates) > 1 && hint.Algorithm != "" && !key.Compatible(candidate.Key, hint.Algorithm) {
+			log.Trace().Msgf("Key [%s] not compatible with algorithm %s", candidate.KeyID, hint.Algorithm)
+			continue
+		}
+		if candidate.fromSet && !candidate.keyPair.Usable(hint.Use, hint.Algorithm) {
+			log.Trace().Msgf("Key [%s] use [%s] alg [%s] not usable for %s", candidate.KeyID, candidate.keyPair.Use, candidate.keyPair.Algorithm, hint.Algorithm)
+			continue
+		}
+		if candidate.keyPair.Matches(hint) || (hint.KeyID != "" && candidate.KeyID == hint.KeyID) {
+			matching = append(matching, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+	return append(matching, others...)
+}
 
-	log.Info().Msg("JWT decrypted with success")
+func verifyJWT(result *DecodeResult, signOptions SignOptions) error {
+	err := verifyInnerJWT(result, signOptions)
+	if verification := result.Verification; verification != nil {
+		alg, _ := verification.Token.Header["alg"].(string)
+		contentType, _ := verification.Token.Header["cty"].(string)
+		result.Layers = append(result.Layers, Layer{
+			Type:           FormatJWS,
+			Algorithm:      alg,
+			ContentType:    contentType,
+			KeyID:          verification.KeyID,
+			SignatureValid: verification.SignatureValid,
+		})
+	}
+	return err
+}
 
-	return decryptedData, token
+func verifyInnerJWT(result *DecodeResult, signOptions SignOptions) error {
+	if signOptions.PublicKey == nil && (signOptions.Trust == nil || !signOptions.Trust.AllowX5C) {
+		log.Warn().Msg("No sign key provided, token signature not verified")
+		token, _, err := jwt.NewParser().ParseUnverified(result.Plaintext, jwt.MapClaims{})
+		if err != nil {
+			return wrapError(ErrParse, err)
+		}
+		result.Verification = &VerifyResult{Token: token}
+		result.Verification.addReason("signature not verified: no sign key provided")
+		return result.Verification.validateClaims(signOptions.Validation)
+	}
+	var err error
+	result.Verification, err = Verify(result.Plaintext, signOptions)
+	return err
 }
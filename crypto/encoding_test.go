@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+func newCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, privateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &privateKey.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, privateKey
+}
+
+func TestDecodeX5CSignedJWT(t *testing.T) {
+	ca, caKey := newCertificate(t, "test CA", nil, nil)
+	leaf, leafKey := newCertificate(t, "signer", ca, caKey)
+	encryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &key.KeySet{Keys: []key.JWKeyPair{{
+		PrivateKey:   leafKey,
+		PublicKey:    &leafKey.PublicKey,
+		Certificates: []*x509.Certificate{leaf, ca},
+	}}}
+	token, _, err := Encode(`{"sub":"alice"}`, EncodeOptions{
+		Algorithm:  "RSA-OAEP",
+		Encoding:   "A256GCM",
+		Recipients: []Recipient{{Algorithm: "RSA-OAEP", Key: &encryptionKey.PublicKey}},
+		Nesting:    NestingSignEncrypt,
+	}, SignOptions{Algorithm: "ES256", PrivateKey: signer, Duration: "1h", KeyHeaders: KeyHeaders{X5C: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodeOptions := EncodeOptions{Recipients: []Recipient{{Key: encryptionKey}}}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	result, err := Decode(token, decodeOptions, SignOptions{Trust: &key.TrustOptions{Roots: roots, AllowX5C: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Verification == nil || !result.Verification.SignatureValid {
+		t.Fatalf("inner JWT not verified: %+v", result.Verification)
+	}
+	if sub := result.Verification.Token.Claims.(jwt.MapClaims)["sub"]; sub != "alice" {
+		t.Fatalf("sub = %v", sub)
+	}
+
+	other, _ := newCertificate(t, "other CA", nil, nil)
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other)
+	if _, err := Decode(token, decodeOptions, SignOptions{Trust: &key.TrustOptions{Roots: untrusted, AllowX5C: true}}); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected ErrSignatureInvalid with an untrusted CA, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrParse            = errors.New("unable to parse token")
+	ErrInvalidPayload   = errors.New("invalid payload")
+	ErrEncrypt          = errors.New("unable to encrypt token")
+	ErrDecrypt          = errors.New("unable to decrypt token")
+	ErrSign             = errors.New("unable to sign token")
+	ErrSignatureInvalid = errors.New("token signature is invalid")
+	ErrClaimsExpired    = errors.New("token claims expired or not yet valid")
+	ErrClaimsInvalid    = errors.New("token claims not valid")
+	ErrKeyNotFound      = errors.New("key not found")
+)
+
+func wrapError(sentinel error, err error) error {
+	if err == nil {
+		return sentinel
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
+
+func verifyError(err error) error {
+	switch {
+	case errors.Is(err, ErrKeyNotFound), errors.Is(err, ErrSignatureInvalid), errors.Is(err, ErrParse):
+		return err
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return wrapError(ErrParse, err)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return wrapError(ErrSignatureInvalid, err)
+	case errors.Is(err, jwt.ErrTokenExpired),
+		errors.Is(err, jwt.ErrTokenNotValidYet),
+		errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return wrapError(ErrClaimsExpired, err)
+	}
+	return wrapError(ErrSignatureInvalid, err)
+}
@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+const (
+	FormatJWE = "JWE"
+	FormatJWS = "JWS"
+)
+
+func DetectFormat(data string) string {
+	trimmed := strings.TrimSpace(data)
+	if strings.HasPrefix(trimmed, "{") {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+			return ""
+		}
+		if _, ok := raw["ciphertext"]; ok {
+			return FormatJWE
+		}
+		if _, ok := raw["payload"]; ok {
+			if _, ok := raw["signature"]; ok {
+				return FormatJWS
+			}
+			if _, ok := raw["signatures"]; ok {
+				return FormatJWS
+			}
+		}
+		return ""
+	}
+	parts := strings.Split(trimmed, ".")
+	if len(parts) != 3 && len(parts) != 5 {
+		return ""
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ""
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(header, &fields); err != nil {
+		return ""
+	}
+	if _, ok := fields["alg"]; !ok {
+		return ""
+	}
+	if len(parts) == 5 {
+		return FormatJWE
+	}
+	return FormatJWS
+}
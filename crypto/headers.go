@@ -0,0 +1,196 @@
+package crypto
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+type KeyHeaders struct {
+	X5C     bool
+	X5T     bool
+	X5TS256 bool
+	JWK     bool
+	JKU     string
+	X5U     string
+}
+
+func ParseKeyHeaders(values []string) (KeyHeaders, error) {
+	var headers KeyHeaders
+	for _, value := range values {
+		name, url, _ := strings.Cut(value, "=")
+		switch name {
+		case "x5c":
+			headers.X5C = true
+		case "x5t":
+			headers.X5T = true
+		case "x5t#S256":
+			headers.X5TS256 = true
+		case "jwk":
+			headers.JWK = true
+		case "jku":
+			headers.JKU = url
+		case "x5u":
+			headers.X5U = url
+		default:
+			return headers, fmt.Errorf("key header [%s] not supported, use x5c|x5t|x5t#S256|jwk|jku=<url>|x5u=<url>", value)
+		}
+		if (name == "jku" || name == "x5u") && !strings.HasPrefix(url, "https://") {
+			return headers, fmt.Errorf("key header %s requires an https URL, found [%s]", name, url)
+		}
+	}
+	return headers, nil
+}
+
+func (h KeyHeaders) empty() bool {
+	return h == KeyHeaders{}
+}
+
+func (h KeyHeaders) perKey() bool {
+	return h.X5C || h.X5T || h.X5TS256 || h.JWK || h.X5U != ""
+}
+
+func (h KeyHeaders) build(pair key.JWKeyPair) (map[string]interface{}, error) {
+	headers := map[string]interface{}{}
+	if h.X5C || h.X5T || h.X5TS256 {
+		if len(pair.Certificates) == 0 {
+			return nil, errors.New("x5c, x5t and x5t#S256 headers require a key loaded from a certificate or PKCS12")
+		}
+	}
+	if h.X5C {
+		chain := make([]string, len(pair.Certificates))
+		for i, certificate := range pair.Certificates {
+			chain[i] = base64.StdEncoding.EncodeToString(certificate.Raw)
+		}
+		headers["x5c"] = chain
+	}
+	if h.X5T {
+		sum := sha1.Sum(pair.Certificates[0].Raw)
+		headers["x5t"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	if h.X5TS256 {
+		sum := sha256.Sum256(pair.Certificates[0].Raw)
+		headers["x5t#S256"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	if h.JWK {
+		if _, symmetric := pair.PublicKey.([]byte); symmetric || pair.PublicKey == nil {
+			return nil, errors.New("jwk header requires an asymmetric key")
+		}
+		data, err := key.MarshalKeyPairs([]key.JWKeyPair{{PublicKey: pair.PublicKey, KeyID: pair.KeyID}}, key.FormatJWK)
+		if err != nil {
+			return nil, err
+		}
+		headers["jwk"] = json.RawMessage(data)
+	}
+	if h.JKU != "" {
+		headers["jku"] = h.JKU
+	}
+	if h.X5U != "" {
+		headers["x5u"] = h.X5U
+	}
+	return headers, nil
+}
+
+var registeredHeaders = map[string]bool{
+	"alg": true, "enc": true, "zip": true, "jku": true, "jwk": true, "kid": true,
+	"x5u": true, "x5c": true, "x5t": true, "x5t#S256": true, "typ": true, "cty": true,
+	"crit": true, "epk": true, "apu": true, "apv": true, "iv": true, "tag": true,
+	"p2s": true, "p2c": true, "b64": true,
+}
+
+func validateHeaders(headers map[string]interface{}, reserved ...string) error {
+	for _, name := range reserved {
+		if _, ok := headers[name]; ok {
+			return fmt.Errorf("header %s is set by the tool and cannot be overridden", name)
+		}
+	}
+	if _, ok := headers["crit"]; !ok {
+		return nil
+	}
+	_, err := criticalHeaders(headers)
+	return err
+}
+
+func rejectCritical(headers map[string]interface{}) error {
+	if _, ok := headers["crit"]; ok {
+		return errors.New("crit header is supported on the JWT layer only")
+	}
+	return nil
+}
+
+func criticalHeaders(header map[string]interface{}) ([]string, error) {
+	value, ok := header["crit"]
+	if !ok {
+		return nil, nil
+	}
+	var names []string
+	switch list := value.(type) {
+	case []string:
+		names = list
+	case []interface{}:
+		for _, entry := range list {
+			name, ok := entry.(string)
+			if !ok {
+				return nil, fmt.Errorf("crit header entry %v is not a string", entry)
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, fmt.Errorf("crit header must be an array of header names, found %v", value)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("crit header must not be empty")
+	}
+	for _, name := range names {
+		if registeredHeaders[name] {
+			return nil, fmt.Errorf("crit header lists registered header %s", name)
+		}
+		if _, ok := header[name]; !ok {
+			return nil, fmt.Errorf("crit header lists %s which is not present in the header", name)
+		}
+	}
+	return names, nil
+}
+
+func checkCritical(header map[string]interface{}, understood []string) ([]string, error) {
+	names, err := criticalHeaders(header)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		supported := false
+		for _, u := range understood {
+			supported = supported || u == name
+		}
+		if !supported {
+			return nil, fmt.Errorf("critical header %s not understood", name)
+		}
+	}
+	return names, nil
+}
+
+func extraHeaders(header jose.Header) map[string]interface{} {
+	headers := map[string]interface{}{}
+	for name, value := range header.ExtraHeaders {
+		headers[string(name)] = value
+	}
+	return headers
+}
+
+func withHeaders(headers map[string]interface{}, set func(jose.HeaderKey, interface{})) error {
+	for name, value := range headers {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		set(jose.HeaderKey(name), json.RawMessage(data))
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type Inspection struct {
+	Format         string                 `json:"format"`
+	Serialization  string                 `json:"serialization"`
+	Verified       bool                   `json:"verified"`
+	Protected      map[string]interface{} `json:"protected,omitempty"`
+	Unprotected    map[string]interface{} `json:"unprotected,omitempty"`
+	Signatures     []InspectedSignature   `json:"signatures,omitempty"`
+	Recipients     []InspectedRecipient   `json:"recipients,omitempty"`
+	PayloadSize    int                    `json:"payload_size,omitempty"`
+	Payload        string                 `json:"payload,omitempty"`
+	Claims         map[string]interface{} `json:"claims,omitempty"`
+	Times          []ClaimTime            `json:"times,omitempty"`
+	IVSize         int                    `json:"iv_size,omitempty"`
+	CiphertextSize int                    `json:"ciphertext_size,omitempty"`
+	TagSize        int                    `json:"tag_size,omitempty"`
+	AADSize        int                    `json:"aad_size,omitempty"`
+	Nested         *Inspection            `json:"nested,omitempty"`
+	Warnings       []string               `json:"warnings,omitempty"`
+}
+
+type InspectedSignature struct {
+	Protected map[string]interface{} `json:"protected,omitempty"`
+	Header    map[string]interface{} `json:"header,omitempty"`
+	Size      int                    `json:"size"`
+}
+
+type InspectedRecipient struct {
+	Header           map[string]interface{} `json:"header,omitempty"`
+	EncryptedKeySize int                    `json:"encrypted_key_size"`
+}
+
+type ClaimTime struct {
+	Claim    string    `json:"claim"`
+	Time     time.Time `json:"time"`
+	Relative string    `json:"relative"`
+}
+
+type jsonSerialization struct {
+	Payload      *string                `json:"payload"`
+	Protected    string                 `json:"protected"`
+	Header       map[string]interface{} `json:"header"`
+	Signature    *string                `json:"signature"`
+	Signatures   []jsonSignature        `json:"signatures"`
+	Unprotected  map[string]interface{} `json:"unprotected"`
+	EncryptedKey string                 `json:"encrypted_key"`
+	Recipients   []jsonRecipient        `json:"recipients"`
+	AAD          string                 `json:"aad"`
+	IV           string                 `json:"iv"`
+	Ciphertext   string                 `json:"ciphertext"`
+	Tag          string                 `json:"tag"`
+}
+
+type jsonSignature struct {
+	Protected string                 `json:"protected"`
+	Header    map[string]interface{} `json:"header"`
+	Signature string                 `json:"signature"`
+}
+
+type jsonRecipient struct {
+	Header       map[string]interface{} `json:"header"`
+	EncryptedKey string                 `json:"encrypted_key"`
+}
+
+func Inspect(payload string, now time.Time) (*Inspection, error) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	inspection := &Inspection{Format: DetectFormat(payload)}
+	var err error
+	switch {
+	case inspection.Format == "":
+		return nil, wrapError(ErrParse, errors.New("neither a JWS nor a JWE"))
+	case strings.HasPrefix(strings.TrimSpace(payload), "{"):
+		err = inspection.parseJSON(strings.TrimSpace(payload), now)
+	default:
+		err = inspection.parseCompact(strings.TrimSpace(payload), now)
+	}
+	if err != nil {
+		return nil, wrapError(ErrParse, err)
+	}
+	return inspection, nil
+}
+
+func (i *Inspection) parseCompact(payload string, now time.Time) error {
+	i.Serialization = SerializationCompact
+	parts := strings.Split(payload, ".")
+	header, err := decodeHeader(parts[0])
+	if err != nil {
+		return err
+	}
+	if i.Format == FormatJWE {
+		i.Protected = header
+		i.warnHeader("protected header", header)
+		encryptedKey, err := decodeSegment("encrypted key", parts[1])
+		if err != nil {
+			return err
+		}
+		i.Recipients = []InspectedRecipient{{EncryptedKeySize: len(encryptedKey)}}
+		return i.setEncrypted(parts[2], parts[3], parts[4], "")
+	}
+	signature, err := decodeSegment("signature", parts[2])
+	if err != nil {
+		return err
+	}
+	i.Signatures = []InspectedSignature{{Protected: header, Size: len(signature)}}
+	i.warnHeader("protected header", header)
+	return i.setPayload(parts[1], now)
+}
+
+func (i *Inspection) parseJSON(payload string, now time.Time) error {
+	var raw jsonSerialization
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		return err
+	}
+	i.Serialization = SerializationJSON
+	if i.Format == FormatJWE {
+		if raw.Recipients == nil {
+			i.Serialization = SerializationFlattened
+			raw.Recipients = []jsonRecipient{{Header: raw.Header, EncryptedKey: raw.EncryptedKey}}
+		}
+		if raw.Protected != "" {
+			header, err := decodeHeader(raw.Protected)
+			if err != nil {
+				return err
+			}
+			i.Protected = header
+			i.warnHeader("protected header", header)
+		}
+		i.Unprotected = raw.Unprotected
+		i.warnHeader("unprotected header", raw.Unprotected)
+		for n, r := range raw.Recipients {
+			encryptedKey, err := decodeSegment("encrypted key", r.EncryptedKey)
+			if err != nil {
+				return err
+			}
+			i.Recipients = append(i.Recipients, InspectedRecipient{Header: r.Header, EncryptedKeySize: len(encryptedKey)})
+			i.warnHeader(fmt.Sprintf("recipient %d header", n), r.Header)
+		}
+		return i.setEncrypted(raw.IV, raw.Ciphertext, raw.Tag, raw.AAD)
+	}
+	if raw.Payload == nil {
+		return errors.New("missing payload")
+	}
+	if raw.Signatures == nil {
+		if raw.Signature == nil {
+			return errors.New("missing signature")
+		}
+		i.Serialization = SerializationFlattened
+		raw.Signatures = []jsonSignature{{Protected: raw.Protected, Header: raw.Header, Signature: *raw.Signature}}
+	}
+	if len(raw.Signatures) == 0 {
+		return errors.New("no signatures")
+	}
+	for n, s := range raw.Signatures {
+		signature := InspectedSignature{Header: s.Header}
+		if s.Protected != "" {
+			header, err := decodeHeader(s.Protected)
+			if err != nil {
+				return err
+			}
+			signature.Protected = header
+		}
+		data, err := decodeSegment("signature", s.Signature)
+		if err != nil {
+			return err
+		}
+		signature.Size = len(data)
+		i.Signatures = append(i.Signatures, signature)
+		i.warnHeader(fmt.Sprintf("signature %d protected header", n), signature.Protected)
+		i.warnHeader(fmt.Sprintf("signature %d header", n), signature.Header)
+	}
+	return i.setPayload(*raw.Payload, now)
+}
+
+func (i *Inspection) setEncrypted(iv string, ciphertext string, tag string, aad string) error {
+	for _, segment := range []struct {
+		name  string
+		value string
+		size  *int
+	}{
+		{"iv", iv, &i.IVSize},
+		{"ciphertext", ciphertext, &i.CiphertextSize},
+		{"tag", tag, &i.TagSize},
+		{"aad", aad, &i.AADSize},
+	} {
+		data, err := decodeSegment(segment.name, segment.value)
+		if err != nil {
+			return err
+		}
+		*segment.size = len(data)
+	}
+	return nil
+}
+
+func (i *Inspection) setPayload(segment string, now time.Time) error {
+	payload, err := decodeSegment("payload", segment)
+	if err != nil {
+		return err
+	}
+	i.PayloadSize = len(payload)
+	if DetectFormat(string(payload)) != "" {
+		i.Nested, err = Inspect(string(payload), now)
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&i.Claims); err != nil {
+		i.Claims = nil
+		i.Payload = string(payload)
+		return nil
+	}
+	i.Times = claimTimes(i.Claims, now)
+	return nil
+}
+
+func (i *Inspection) warnHeader(location string, header map[string]interface{}) {
+	if alg, ok := header["alg"].(string); ok && strings.EqualFold(alg, "none") {
+		i.Warnings = append(i.Warnings, fmt.Sprintf("%s: alg none, the token is not signed", location))
+	}
+	for _, name := range []string{"jku", "x5u"} {
+		if value, ok := header[name]; ok {
+			i.Warnings = append(i.Warnings, fmt.Sprintf("%s: %s %v points to keys chosen by the token issuer, never fetch them without an allow list", location, name, value))
+		}
+	}
+	if _, ok := header["jwk"]; ok {
+		i.Warnings = append(i.Warnings, fmt.Sprintf("%s: embedded jwk, a key supplied by the token must not be trusted for verification", location))
+	}
+	if value, ok := header["zip"]; ok {
+		i.Warnings = append(i.Warnings, fmt.Sprintf("%s: zip %v, compressed payloads can be used for decompression bombs", location, value))
+	}
+	if value, ok := header["crit"]; ok {
+		i.Warnings = append(i.Warnings, fmt.Sprintf("%s: crit %v, these headers must be understood by the recipient", location, value))
+	}
+}
+
+func claimTimes(claims jwt.MapClaims, now time.Time) []ClaimTime {
+	var times []ClaimTime
+	for _, name := range []string{"iat", "nbf", "exp", "auth_time"} {
+		t, ok, err := timeClaim(claims, name)
+		if !ok || err != nil {
+			continue
+		}
+		times = append(times, ClaimTime{Claim: name, Time: t, Relative: relativeTime(name, t, now)})
+	}
+	return times
+}
+
+func relativeTime(name string, t time.Time, now time.Time) string {
+	d := t.Sub(now).Round(time.Second)
+	if d == 0 {
+		return "now"
+	}
+	past := d < 0
+	if past {
+		d = -d
+	}
+	switch {
+	case name == "exp" && past:
+		return fmt.Sprintf("expired %s ago", d)
+	case name == "exp":
+		return fmt.Sprintf("expires in %s", d)
+	case name == "nbf" && past:
+		return fmt.Sprintf("valid since %s ago", d)
+	case name == "nbf":
+		return fmt.Sprintf("not valid for another %s", d)
+	case past:
+		return fmt.Sprintf("%s ago", d)
+	}
+	return fmt.Sprintf("in %s (future)", d)
+}
+
+func decodeHeader(segment string) (map[string]interface{}, error) {
+	data, err := decodeSegment("header", segment)
+	if err != nil {
+		return nil, err
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("header is not a JSON object: %w", err)
+	}
+	return header, nil
+}
+
+func decodeSegment(name string, segment string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64url: %w", name, err)
+	}
+	return data, nil
+}
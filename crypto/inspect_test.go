@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInspectMalformedJSON(t *testing.T) {
+	for _, payload := range []string{
+		`{"payload":"e30","signatures":null}`,
+		`{"payload":"e30","signature":null}`,
+		`{"payload":"e30"}`,
+		`{"payload":null,"signature":"c2ln"}`,
+		`{"payload":null,"signatures":[{"signature":"c2ln"}]}`,
+		`{"signatures":[{"signature":"c2ln"}]}`,
+		`{"payload":"e30","signatures":[]}`,
+	} {
+		t.Run(payload, func(t *testing.T) {
+			if _, err := Inspect(payload, time.Time{}); !errors.Is(err, ErrParse) {
+				t.Fatalf("expected ErrParse, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInspectFlattenedJSON(t *testing.T) {
+	inspection, err := Inspect(`{"payload":"e30","protected":"eyJhbGciOiJIUzI1NiJ9","signature":"c2ln"}`, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inspection.Serialization != SerializationFlattened || len(inspection.Signatures) != 1 {
+		t.Fatalf("inspection = %+v", inspection)
+	}
+}
@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+func isJWT(payload string) bool {
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	obj, err := jose.ParseSigned(payload)
+	if err != nil {
+		return false
+	}
+	signedPayload := obj.UnsafePayloadWithoutVerification()
+	if DetectFormat(string(signedPayload)) != "" {
+		return false
+	}
+	var claims map[string]interface{}
+	return json.Unmarshal(signedPayload, &claims) == nil
+}
+
+func signNested(payload string, signOptions SignOptions) (string, error) {
+	pair, err := key.ResolvePair(signOptions.PrivateKey, false, signOptions.Kid)
+	if err != nil {
+		return "", wrapError(ErrKeyNotFound, err)
+	}
+	signingKey := jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(signOptions.Algorithm),
+		Key: jose.JSONWebKey{
+			Key:   pair.PrivateKey,
+			KeyID: signOptions.Kid,
+		},
+	}
+	signerOptions := (&jose.SignerOptions{}).WithContentType("JWT")
+	if !signOptions.KeyHeaders.empty() {
+		headers, err := signOptions.KeyHeaders.build(*pair)
+		if err != nil {
+			return "", wrapError(ErrSign, err)
+		}
+		for name, value := range headers {
+			signerOptions.WithHeader(jose.HeaderKey(name), value)
+		}
+	}
+	if err := rejectCritical(signOptions.Headers); err != nil {
+		return "", wrapError(ErrSign, err)
+	}
+	if err := validateHeaders(signOptions.Headers, "alg"); err != nil {
+		return "", wrapError(ErrSign, err)
+	}
+	if err := withHeaders(signOptions.Headers, func(k jose.HeaderKey, v interface{}) { signerOptions.WithHeader(k, v) }); err != nil {
+		return "", wrapError(ErrSign, err)
+	}
+	signer, err := jose.NewSigner(signingKey, signerOptions)
+	if err != nil {
+		return "", wrapError(ErrSign, err)
+	}
+	obj, err := signer.Sign([]byte(payload))
+	if err != nil {
+		return "", wrapError(ErrSign, err)
+	}
+	signed, err := obj.CompactSerialize()
+	if err != nil {
+		return "", wrapError(ErrSign, err)
+	}
+	log.Info().Msg("Signed nested payload with success.")
+	return signed, nil
+}
+
+func verifyLayer(payload string, signOptions SignOptions) (Layer, string, error) {
+	obj, err := jose.ParseSigned(payload)
+	if err != nil {
+		return Layer{Type: FormatJWS}, "", wrapError(ErrParse, err)
+	}
+	header := obj.Signatures[0].Header
+	contentType, _ := header.ExtraHeaders[jose.HeaderContentType].(string)
+	layer := Layer{
+		Type:        FormatJWS,
+		Algorithm:   header.Algorithm,
+		ContentType: contentType,
+		KeyID:       header.KeyID,
+	}
+	if critical, err := checkCritical(extraHeaders(header), signOptions.Critical); err != nil {
+		return layer, "", wrapError(ErrSignatureInvalid, err)
+	} else if len(critical) > 0 {
+		return layer, "", wrapError(ErrSignatureInvalid, fmt.Errorf("critical headers %v are supported on the JWT layer only", critical))
+	}
+
+	if signOptions.PublicKey == nil && (signOptions.Trust == nil || !signOptions.Trust.AllowX5C) {
+		log.Warn().Msg("No sign key provided, JWS signature not verified")
+		return layer, string(obj.UnsafePayloadWithoutVerification()), nil
+	}
+	hint := keyHint("sig", header.KeyID, header.Algorithm, header.ExtraHeaders["x5t"], header.ExtraHeaders["x5t#S256"])
+	x5c, err := headerCertificates(payload)
+	if err != nil {
+		return layer, "", wrapError(ErrParse, err)
+	}
+	var claims map[string]interface{}
+	_ = json.Unmarshal(obj.UnsafePayloadWithoutVerification(), &claims)
+	candidates, err := selectVerifyKeys(signOptions, hint, x5c, claims)
+	if err != nil {
+		return layer, "", err
+	}
+	var failures []string
+	for i, candidate := range candidates {
+		index, _, signedPayload, err := obj.VerifyMulti(candidate.PublicKey)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Verify with key %d [%s] failed", i, candidate.KeyID)
+			failures = append(failures, fmt.Sprintf("key %d: %v", i, err))
+			continue
+		}
+		layer.Recipient = index
+		layer.Key = i
+		if candidate.KeyID != "" {
+			layer.KeyID = candidate.KeyID
+		}
+		layer.SignatureValid = true
+		log.Info().Msg("Verified JWS layer with success.")
+		return layer, string(signedPayload), nil
+	}
+	return layer, "", wrapError(ErrSignatureInvalid, errors.New(strings.Join(failures, "; ")))
+}
+
+func keyHint(use string, kid string, alg string, x5t interface{}, x5tS256 interface{}) key.KeyHint {
+	hint := key.KeyHint{KeyID: kid, Algorithm: alg, Use: use}
+	for _, thumbprint := range []interface{}{x5tS256, x5t} {
+		if value, ok := thumbprint.(string); ok && value != "" {
+			hint.Thumbprints = append(hint.Thumbprints, value)
+		}
+	}
+	return hint
+}
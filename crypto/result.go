@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type VerifyResult struct {
+	Token          *jwt.Token `json:"-"`
+	KeyID          string     `json:"kid,omitempty"`
+	SignatureValid bool       `json:"signature_valid"`
+	ClaimsValid    bool       `json:"claims_valid"`
+	Reasons        []string   `json:"reasons,omitempty"`
+}
+
+func (r *VerifyResult) Valid() bool {
+	return r != nil && r.SignatureValid && r.ClaimsValid
+}
+
+func (r *VerifyResult) addReason(format string, args ...interface{}) {
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, args...))
+}
+
+func (r *VerifyResult) validateClaims(options ValidationOptions) error {
+	claims, ok := r.Token.Claims.(jwt.MapClaims)
+	if !ok {
+		r.ClaimsValid = false
+		r.addReason("claims are not a JSON object")
+		return wrapError(ErrClaimsInvalid, errors.New("claims are not a JSON object"))
+	}
+	violations := options.validate(claims)
+	r.ClaimsValid = len(violations) == 0
+	if r.ClaimsValid {
+		return nil
+	}
+	var messages []string
+	var expired, invalid bool
+	for _, v := range violations {
+		messages = append(messages, v.message)
+		expired = expired || v.time
+		invalid = invalid || !v.time
+	}
+	r.Reasons = append(r.Reasons, messages...)
+	err := errors.New(strings.Join(messages, "; "))
+	if expired {
+		err = wrapError(ErrClaimsExpired, err)
+	}
+	if invalid {
+		err = wrapError(ErrClaimsInvalid, err)
+	}
+	return err
+}
@@ -1,8 +1,9 @@
 package crypto
 
 import (
-	"encoding/json"
-	"time"
+	"crypto/x509"
+	"errors"
+	"fmt"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog/log"
@@ -15,93 +16,134 @@ type SignOptions struct {
 	PublicKey  interface{}
 	Kid        string
 	Duration   string
+	TimeClaims TimeClaimsOptions
+	Validation ValidationOptions
+	Trust      *key.TrustOptions
+	KeyHeaders KeyHeaders
+	Headers    map[string]interface{}
+	Critical   []string
 }
 
-func Sign(payload string, signOptions SignOptions) (string, jwt.Token) {
+func (o SignOptions) String() string {
+	return fmt.Sprintf("{Algorithm:%s Kid:%s PrivateKey:%s PublicKey:%s Duration:%s}", o.Algorithm, o.Kid, describeKey(o.PrivateKey), describeKey(o.PublicKey), o.Duration)
+}
+
+func (o SignOptions) GoString() string {
+	return o.String()
+}
 
-	log.Debug().Msgf("Signing with options: %#v", signOptions)
+func Sign(payload string, signOptions SignOptions) (string, *jwt.Token, error) {
 
-	var claims jwt.MapClaims
-	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
-		log.Fatal().Err(err).Msg("Error during payload unmarshall")
-	}
-	duration, err := time.ParseDuration(signOptions.Duration)
+	log.Debug().Msgf("Signing with options: %v", signOptions)
+
+	claims, err := decodeClaims([]byte(payload))
 	if err != nil {
-		log.Warn().Msgf("Token duration %s not valid, reset to 1h", signOptions.Duration)
-		duration = time.Hour
+		return "", nil, wrapError(ErrInvalidPayload, err)
+	}
+	method := jwt.GetSigningMethod(signOptions.Algorithm)
+	if method == nil {
+		return "", nil, wrapError(ErrSign, fmt.Errorf("signing algorithm [%s] not supported", signOptions.Algorithm))
+	}
+	if err := stampClaims(claims, signOptions.Duration, signOptions.TimeClaims); err != nil {
+		return "", nil, wrapError(ErrSign, err)
 	}
-	now := time.Now()
-	nowEpoch := now.Unix()
-	claims["iat"] = nowEpoch
-	claims["nbf"] = nowEpoch
-	claims["exp"] = now.Add(duration).Unix()
-	token := jwt.NewWithClaims(jwt.GetSigningMethod(signOptions.Algorithm), claims)
+	token := jwt.NewWithClaims(method, jwt.MapClaims(claims))
 	if signOptions.Kid != "" {
 		token.Header["kid"] = signOptions.Kid
 	}
 
 	log.Trace().Msgf("Signing token %#v ...", token)
 
-	tokenData, err := token.SignedString(signOptions.PrivateKey)
+	pair, err := key.ResolvePair(signOptions.PrivateKey, false, signOptions.Kid)
+	if err != nil {
+		return "", nil, wrapError(ErrKeyNotFound, err)
+	}
+	if !signOptions.KeyHeaders.empty() {
+		headers, err := signOptions.KeyHeaders.build(*pair)
+		if err != nil {
+			return "", nil, wrapError(ErrSign, err)
+		}
+		for name, value := range headers {
+			token.Header[name] = value
+		}
+	}
+	if err := validateHeaders(signOptions.Headers, "alg"); err != nil {
+		return "", nil, wrapError(ErrSign, err)
+	}
+	for name, value := range signOptions.Headers {
+		token.Header[name] = value
+	}
+	tokenData, err := token.SignedString(pair.PrivateKey)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error signing Token")
+		return "", nil, wrapError(ErrSign, err)
 	}
+	token.Raw = tokenData
 	log.Info().Msg("Signed Token with success.")
 
-	return tokenData, *token
+	return tokenData, token, nil
 }
 
-func Verify(payload string, signOptions SignOptions) jwt.Token {
+func Verify(payload string, signOptions SignOptions) (*VerifyResult, error) {
 
-	log.Debug().Msgf("Verify with options: %#v", signOptions)
+	log.Debug().Msgf("Verify with options: %v", signOptions)
 
-	token, err := jwt.Parse(payload, func(token *jwt.Token) (interface{}, error) {
-
-		_, publicKey, err := key.ResolveKeyPair(signOptions.PublicKey, true, signOptions.Kid)
-		if err != nil {
-			log.Error().Err(err).Msg("sign key not found")
+	result := &VerifyResult{KeyID: signOptions.Kid}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	var candidates []key.JWKeyPair
+	attempt := 0
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if candidates == nil {
+			if _, err := checkCritical(token.Header, signOptions.Critical); err != nil {
+				return nil, wrapError(ErrSignatureInvalid, err)
+			}
+			if result.KeyID == "" {
+				result.KeyID, _ = token.Header["kid"].(string)
+			}
+			alg, _ := token.Header["alg"].(string)
+			kid, _ := token.Header["kid"].(string)
+			var x5c []*x509.Certificate
+			if values, ok := token.Header["x5c"].([]interface{}); ok {
+				var err error
+				if x5c, err = key.ParseCertificateChain(values); err != nil {
+					return nil, wrapError(ErrParse, err)
+				}
+			}
+			claims, _ := token.Claims.(jwt.MapClaims)
+			var err error
+			candidates, err = selectVerifyKeys(signOptions, keyHint("sig", kid, alg, token.Header["x5t"], token.Header["x5t#S256"]), x5c, claims)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return candidates[attempt].PublicKey, nil
+	}
+	token, err := parser.Parse(payload, keyFunc)
+	for err != nil && errors.Is(err, jwt.ErrTokenSignatureInvalid) && attempt+1 < len(candidates) {
+		log.Debug().Err(err).Msgf("Signature not valid with key %d [%s], trying next key", attempt, candidates[attempt].KeyID)
+		attempt++
+		token, err = parser.Parse(payload, keyFunc)
+	}
+	if err == nil && candidates[attempt].KeyID != "" {
+		result.KeyID = candidates[attempt].KeyID
+	}
+	if err != nil {
+		err = verifyError(err)
+		if token == nil || errors.Is(err, ErrParse) {
 			return nil, err
 		}
-		return publicKey, nil
+		result.addReason(err.Error())
+	} else {
+		result.SignatureValid = true
+	}
+	result.Token = token
 
-		// if reflect.ValueOf(signOptions.PublicKey).Kind() == reflect.Map {
-		// 	keyMap, valid := signOptions.PublicKey.(map[string]interface{})
-		// 	if !valid {
-		// 		return nil, errors.New("invalid JsokWebKey")
-		// 	}
-		// 	log.Trace().Msgf("jsonWebKeySet: %#v", keyMap)
-		// 	if tokenKid, ok := token.Header["kid"]; ok {
-		// 		if signOptions.Kid != "" && signOptions.Kid != tokenKid.(string) {
-		// 			return nil, fmt.Errorf("mismatched keys: specified [%s] found [%s]", signOptions.Kid, tokenKid)
-		// 		}
-		// 	}
-		// 	if signOptions.Kid != "" {
-		// 		if key, ok := keyMap[signOptions.Kid]; ok {
-		// 			log.Trace().Msgf("jsonWebKey matched %s", signOptions.Kid)
-		// 			return key, nil
-		// 		} else {
-		// 			return nil, fmt.Errorf("jsonWebKey [%s] not found", signOptions.Kid)
-		// 		}
-		// 	}
-		// 	if len(keyMap) == 0 {
-		// 		return nil, errors.New("JsonWebKey empty")
-		// 	} else if len(keyMap) > 1 {
-		// 		return nil, errors.New("multiple JsonWebKey found")
-		// 	}
-		// 	var key interface{}
-		// 	for _, k := range keyMap {
-		// 		key = k
-		// 		break
-		// 	}
-		// 	return key, nil
-		// } else {
-		// 	return signOptions.PublicKey, nil
-		// }
-	})
+	if claimsErr := result.validateClaims(signOptions.Validation); claimsErr != nil && err == nil {
+		err = claimsErr
+	}
 	if err != nil {
-		log.Warn().Err(err).Msg("Verification Token failed")
-	} else {
-		log.Info().Msg("Verified Token with success.")
+		log.Warn().Strs("reasons", result.Reasons).Msg("Verification Token failed")
+		return result, err
 	}
-	return *token
+	log.Info().Msg("Verified Token with success.")
+	return result, nil
 }
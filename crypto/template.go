@@ -0,0 +1,111 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.step.sm/crypto/randutil"
+)
+
+type TemplateOptions struct {
+	Variables map[string]interface{}
+	Now       time.Time
+}
+
+type templateString string
+
+func (s templateString) String() string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(string(s)); err != nil {
+		return ""
+	}
+	quoted := strings.TrimSuffix(out.String(), "\n")
+	return quoted[1 : len(quoted)-1]
+}
+
+func escapeVariables(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return templateString(v)
+	case []interface{}:
+		escaped := make([]interface{}, len(v))
+		for i, entry := range v {
+			escaped[i] = escapeVariables(entry)
+		}
+		return escaped
+	case map[string]interface{}:
+		escaped := make(map[string]interface{}, len(v))
+		for name, entry := range v {
+			escaped[name] = escapeVariables(entry)
+		}
+		return escaped
+	}
+	return value
+}
+
+func templateText(value interface{}) string {
+	if s, ok := value.(templateString); ok {
+		return string(s)
+	}
+	return fmt.Sprint(value)
+}
+
+func RenderTemplate(name string, text []byte, options TemplateOptions) ([]byte, error) {
+	now := options.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	variables := map[string]interface{}{}
+	for name, value := range options.Variables {
+		variables[name] = escapeVariables(value)
+	}
+	funcs := template.FuncMap{
+		"now": func() int64 {
+			return now.Unix()
+		},
+		"add": func(value interface{}) (int64, error) {
+			duration := templateText(value)
+			d, err := time.ParseDuration(duration)
+			if err != nil {
+				return 0, fmt.Errorf("duration %s not valid: %w", duration, err)
+			}
+			return now.Add(d).Unix(), nil
+		},
+		"uuid": randutil.UUIDv4,
+		"env": func(value interface{}) (templateString, error) {
+			name := templateText(value)
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s not set", name)
+			}
+			return templateString(env), nil
+		},
+		"file": func(value interface{}) (templateString, error) {
+			data, err := os.ReadFile(templateText(value))
+			if err != nil {
+				return "", err
+			}
+			return templateString(strings.TrimRight(string(data), "\r\n")), nil
+		},
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(string(text))
+	if err != nil {
+		return nil, wrapError(ErrInvalidPayload, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, variables); err != nil {
+		return nil, wrapError(ErrInvalidPayload, err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func renderClaims(t *testing.T, text string, variables map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	rendered, err := RenderTemplate("test", []byte(text), TemplateOptions{Variables: variables, Now: time.Unix(1000, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(rendered, &claims); err != nil {
+		t.Fatalf("rendered template is not valid JSON: %v\n%s", err, rendered)
+	}
+	return claims
+}
+
+func TestRenderTemplateInjection(t *testing.T) {
+	injection := `x","admin":true,"y":"`
+	t.Setenv("JWE_TOOL_TEST_USER", injection)
+	claims := renderClaims(t, `{
+		"sub": "{{ .user }}",
+		"json": {{ json .user }},
+		"role": "{{ index .roles 0 }}",
+		"roles": {{ json .roles }},
+		"org": "{{ .org.name }}",
+		"env": "{{ env "JWE_TOOL_TEST_USER" }}",
+		"env_json": {{ env "JWE_TOOL_TEST_USER" | json }}
+	}`, map[string]interface{}{
+		"user":  injection,
+		"roles": []interface{}{injection},
+		"org":   map[string]interface{}{"name": injection},
+	})
+	if _, ok := claims["admin"]; ok {
+		t.Fatalf("template variable injected a claim: %v", claims)
+	}
+	for _, name := range []string{"sub", "json", "role", "org", "env", "env_json"} {
+		if claims[name] != injection {
+			t.Errorf("%s = %#v, want %#v", name, claims[name], injection)
+		}
+	}
+	if roles, _ := claims["roles"].([]interface{}); len(roles) != 1 || roles[0] != injection {
+		t.Errorf("roles = %#v", claims["roles"])
+	}
+}
+
+func TestRenderTemplateEscaping(t *testing.T) {
+	value := "quote \" backslash \\ newline \n tab \t <html> & é"
+	claims := renderClaims(t, `{"sub": "{{ .user }}"}`, map[string]interface{}{"user": value})
+	if claims["sub"] != value {
+		t.Fatalf("sub = %#v, want %#v", claims["sub"], value)
+	}
+}
+
+func TestRenderTemplateVariables(t *testing.T) {
+	claims := renderClaims(t, `{
+		"exp": {{ add .ttl }},
+		"admin": {{ if eq .user "root" }}true{{ else }}false{{ end }},
+		"count": {{ .count }}
+	}`, map[string]interface{}{"ttl": "1h", "user": "root", "count": json.Number("3")})
+	if claims["exp"] != float64(1000+3600) {
+		t.Errorf("exp = %v", claims["exp"])
+	}
+	if claims["admin"] != true {
+		t.Errorf("admin = %v", claims["admin"])
+	}
+	if claims["count"] != float64(3) {
+		t.Errorf("count = %v", claims["count"])
+	}
+}
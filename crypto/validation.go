@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type ValidationOptions struct {
+	Issuer         string
+	Audience       []string
+	Subject        string
+	RequiredClaims []string
+	MaxAge         time.Duration
+	Leeway         time.Duration
+	Now            time.Time
+}
+
+type violation struct {
+	message string
+	time    bool
+}
+
+func ParseTime(value string) (time.Time, error) {
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(epoch, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time [%s] is neither RFC 3339 nor epoch seconds", value)
+	}
+	return t, nil
+}
+
+func (o ValidationOptions) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+func (o ValidationOptions) validate(claims jwt.MapClaims) []violation {
+	var violations []violation
+	timeViolation := func(format string, args ...interface{}) {
+		violations = append(violations, violation{message: fmt.Sprintf(format, args...), time: true})
+	}
+	claimViolation := func(format string, args ...interface{}) {
+		violations = append(violations, violation{message: fmt.Sprintf(format, args...)})
+	}
+
+	now := o.now()
+	exp, hasExp, err := timeClaim(claims, "exp")
+	if err != nil {
+		claimViolation("%v", err)
+	} else if hasExp && now.After(exp.Add(o.Leeway)) {
+		timeViolation("token is expired (exp %s)", exp.Format(time.RFC3339))
+	}
+	nbf, hasNbf, err := timeClaim(claims, "nbf")
+	if err != nil {
+		claimViolation("%v", err)
+	} else if hasNbf && now.Add(o.Leeway).Before(nbf) {
+		timeViolation("token is not valid yet (nbf %s)", nbf.Format(time.RFC3339))
+	}
+	iat, hasIat, err := timeClaim(claims, "iat")
+	if err != nil {
+		claimViolation("%v", err)
+	} else if hasIat && now.Add(o.Leeway).Before(iat) {
+		timeViolation("token used before issued (iat %s)", iat.Format(time.RFC3339))
+	}
+	if o.MaxAge > 0 {
+		if !hasIat {
+			claimViolation("max age requires the iat claim")
+		} else if age := now.Sub(iat); age > o.MaxAge+o.Leeway {
+			timeViolation("token is too old (age %s, max %s)", age.Round(time.Second), o.MaxAge)
+		}
+	}
+
+	if o.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != o.Issuer {
+			claimViolation("unexpected issuer [%s], expected [%s]", iss, o.Issuer)
+		}
+	}
+	if o.Subject != "" {
+		if sub, _ := claims["sub"].(string); sub != o.Subject {
+			claimViolation("unexpected subject [%s], expected [%s]", sub, o.Subject)
+		}
+	}
+	if len(o.Audience) > 0 && !matchAudience(claims["aud"], o.Audience) {
+		claimViolation("audience %v does not match any of [%s]", claims["aud"], strings.Join(o.Audience, ", "))
+	}
+	for _, name := range o.RequiredClaims {
+		if _, ok := claims[name]; !ok {
+			claimViolation("required claim [%s] missing", name)
+		}
+	}
+	return violations
+}
+
+func timeClaim(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("claim [%s] is not a number", name)
+		}
+		seconds = f
+	default:
+		return time.Time{}, true, fmt.Errorf("claim [%s] is not a number", name)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+func matchAudience(aud interface{}, expected []string) bool {
+	var audiences []string
+	switch v := aud.(type) {
+	case string:
+		audiences = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	for _, a := range audiences {
+		for _, e := range expected {
+			if a == e {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type stringList struct {
+	values   []string
+	explicit bool
+}
+
+func newStringList(name string, usage string, defaults ...string) *stringList {
+	list := &stringList{values: defaults}
+	flag.Var(list, name, usage)
+	return list
+}
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.values, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	if !l.explicit {
+		l.values = nil
+		l.explicit = true
+	}
+	l.values = append(l.values, value)
+	return nil
+}
+
+func (l *stringList) Values() []string {
+	return l.values
+}
+
+func (l *stringList) At(i int) string {
+	if len(l.values) == 0 {
+		return ""
+	}
+	if i < len(l.values) {
+		return l.values[i]
+	}
+	return l.values[len(l.values)-1]
+}
+
+func parseAssignments(values []string, target map[string]interface{}) error {
+	for _, value := range values {
+		if name, raw, ok := strings.Cut(value, ":="); ok && !strings.Contains(name, "=") {
+			decoded, err := decodeJSON([]byte(raw))
+			if err != nil {
+				return fmt.Errorf("invalid JSON value for %s: %w", name, err)
+			}
+			target[name] = decoded
+			continue
+		}
+		name, text, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid assignment [%s], use name=<string> or name:=<json>", value)
+		}
+		target[name] = text
+	}
+	return nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
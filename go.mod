@@ -4,18 +4,19 @@ go 1.20
 
 require (
 	github.com/fatih/color v1.14.1
-	github.com/go-jose/go-jose/v3 v3.0.0
+	github.com/go-jose/go-jose/v3 v3.0.3
 	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/rs/zerolog v1.29.0
-	go.step.sm/crypto v0.25.2
-	golang.org/x/term v0.5.0
+	go.step.sm/crypto v0.44.2
+	golang.org/x/crypto v0.21.0
+	golang.org/x/term v0.18.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
-	filippo.io/edwards25519 v1.0.0 // indirect
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	golang.org/x/crypto v0.6.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
 )
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/crypto"
+	"github.com/typhoon51280/jwe-tool/ioutil"
+)
+
+func inspect() {
+
+	log.Info().Msg("Start inspecting token ...")
+
+	input := loadTokenInput()
+
+	var now time.Time
+	if len(*validationTime) > 0 {
+		var err error
+		if now, err = crypto.ParseTime(*validationTime); err != nil {
+			log.Fatal().Err(err).Msg("Invalid parameter -now")
+		}
+	}
+	inspection, err := crypto.Inspect(input, now)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error inspecting token")
+	}
+	log.Warn().Msg("UNVERIFIED: neither the signature nor the claims have been checked")
+	for _, warning := range collectWarnings(inspection) {
+		log.Warn().Msg(warning)
+	}
+
+	var text string
+	if *jsonOutput {
+		text = ioutil.PrettyJSON(inspection)
+	} else {
+		text = strings.TrimSuffix(formatInspection(inspection, ""), "\n")
+	}
+	log.Info().Msgf("Token Report |-\n%s", ioutil.PrintText("Token Report (UNVERIFIED)", text, color.BgRed, color.FgWhite, color.Bold))
+	writeResult(text)
+
+	log.Info().Msg("DONE 😀")
+
+}
+
+func collectWarnings(inspection *crypto.Inspection) []string {
+	var warnings []string
+	for ; inspection != nil; inspection = inspection.Nested {
+		warnings = append(warnings, inspection.Warnings...)
+	}
+	return warnings
+}
+
+func formatInspection(inspection *crypto.Inspection, indent string) string {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, indent+format+"\n", args...)
+	}
+	block := func(title string, value interface{}) {
+		line("%s:", title)
+		for _, l := range strings.Split(ioutil.PrettyJSON(value), "\n") {
+			line("  %s", l)
+		}
+	}
+	line("%s (%s serialization), UNVERIFIED", inspection.Format, inspection.Serialization)
+	if inspection.Protected != nil {
+		block("Protected header", inspection.Protected)
+	}
+	if inspection.Unprotected != nil {
+		block("Unprotected header", inspection.Unprotected)
+	}
+	for i, signature := range inspection.Signatures {
+		line("Signature %d: %d bytes", i, signature.Size)
+		if signature.Protected != nil {
+			block("  Protected header", signature.Protected)
+		}
+		if signature.Header != nil {
+			block("  Header", signature.Header)
+		}
+	}
+	for i, recipient := range inspection.Recipients {
+		line("Recipient %d: encrypted key %d bytes", i, recipient.EncryptedKeySize)
+		if recipient.Header != nil {
+			block("  Header", recipient.Header)
+		}
+	}
+	if inspection.Format == crypto.FormatJWE {
+		line("Ciphertext: %d bytes, iv %d bytes, tag %d bytes, aad %d bytes", inspection.CiphertextSize, inspection.IVSize, inspection.TagSize, inspection.AADSize)
+	} else {
+		line("Payload: %d bytes", inspection.PayloadSize)
+	}
+	if inspection.Claims != nil {
+		block("Claims", inspection.Claims)
+	} else if len(inspection.Payload) > 0 {
+		line("Payload (not JSON):")
+		line("  %s", inspection.Payload)
+	}
+	for _, t := range inspection.Times {
+		line("%-9s %s (%s)", t.Claim+":", t.Time.UTC().Format(time.RFC3339), t.Relative)
+	}
+	if len(inspection.Warnings) > 0 {
+		line("Warnings:")
+		for _, warning := range inspection.Warnings {
+			line("  - %s", warning)
+		}
+	}
+	if inspection.Nested != nil {
+		line("Nested token:")
+		b.WriteString(formatInspection(inspection.Nested, indent+"  "))
+	}
+	return b.String()
+}
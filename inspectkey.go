@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/crypto"
+	"github.com/typhoon51280/jwe-tool/ioutil"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+var jsonOutput = flag.Bool("json", false, "inspect and inspect-key: print the report as JSON")
+
+type keyReport struct {
+	Format  string           `json:"format"`
+	Error   string           `json:"error,omitempty"`
+	Keys    []key.KeyInfo    `json:"keys"`
+	Skipped []key.SkippedKey `json:"skipped,omitempty"`
+}
+
+func inspectKey() {
+
+	if len(*inFile) == 0 {
+		log.Fatal().Msg("Missing parameter: -in")
+	}
+
+	log.Info().Msg("Start inspecting key ...")
+
+	keyBytes := ioutil.LoadInput(*inFile)
+	report := keyReport{Format: key.DetectFormat(keyBytes)}
+	log.Info().Msgf("Detected format: %s", report.Format)
+
+	keySet, err := key.LoadKeySet(keyBytes, createLoadOptions("input", ""))
+	if err != nil {
+		report.Error = err.Error()
+	} else {
+		report.Skipped = keySet.Skipped
+		for _, pair := range keySet.Keys {
+			info := key.Describe(pair)
+			info.SigningAlgorithms = crypto.SigningAlgorithms(pair.PublicKey)
+			info.EncryptionAlgorithms = crypto.EncryptionAlgorithms(pair.PublicKey)
+			report.Keys = append(report.Keys, info)
+		}
+	}
+
+	var text string
+	if *jsonOutput {
+		text = ioutil.PrettyJSON(report)
+	} else {
+		text = formatKeyReport(report)
+	}
+	log.Info().Msgf("Key Report |-\n%s", ioutil.PrintText("Key Report", text, color.BgCyan, color.FgWhite, color.Bold))
+	writeResult(text)
+
+	if err != nil {
+		log.Error().Err(err).Msgf("Error loading key %v (shared secrets need an oct JWK)", *inFile)
+		os.Exit(1)
+	}
+	log.Info().Msg("DONE 😀")
+
+}
+
+func formatKeyReport(report keyReport) string {
+	var b strings.Builder
+	line := func(indent string, name string, value interface{}) {
+		if s := fmt.Sprint(value); s != "" && s != "[]" && s != "0" {
+			fmt.Fprintf(&b, "%s%-20s %s\n", indent, name+":", s)
+		}
+	}
+	line("", "Format", report.Format)
+	line("", "Error", report.Error)
+	for i, info := range report.Keys {
+		fmt.Fprintf(&b, "\nKey %d\n", i)
+		visibility := "public"
+		if info.Type == "oct" {
+			visibility = "secret"
+		} else if info.Private {
+			visibility = "private"
+		}
+		line("  ", "Type", strings.TrimSpace(fmt.Sprintf("%s %s", info.Type, info.Curve)))
+		line("  ", "Size", info.Size)
+		line("  ", "Visibility", visibility)
+		line("  ", "Name", info.Name)
+		line("  ", "Key ID", info.KeyID)
+		line("  ", "Use", info.Use)
+		line("  ", "Algorithm", info.Algorithm)
+		line("  ", "Key operations", strings.Join(info.KeyOps, ", "))
+		line("  ", "Thumbprint SHA-1", info.ThumbprintSHA1)
+		line("  ", "Thumbprint SHA-256", info.ThumbprintSHA256)
+		line("  ", "JWS algorithms", strings.Join(info.SigningAlgorithms, ", "))
+		line("  ", "JWE algorithms", strings.Join(info.EncryptionAlgorithms, ", "))
+		for j, certificate := range info.Certificates {
+			fmt.Fprintf(&b, "  Certificate %d\n", j)
+			line("    ", "Subject", certificate.Subject)
+			line("    ", "Issuer", certificate.Issuer)
+			line("    ", "Serial", certificate.SerialNumber)
+			line("    ", "Not before", certificate.NotBefore.Format(time.RFC3339))
+			validity := certificate.NotAfter.Format(time.RFC3339)
+			if time.Now().After(certificate.NotAfter) {
+				validity += " (expired)"
+			}
+			line("    ", "Not after", validity)
+			line("    ", "DNS names", strings.Join(certificate.DNSNames, ", "))
+			line("    ", "Email addresses", strings.Join(certificate.EmailAddresses, ", "))
+			line("    ", "IP addresses", strings.Join(certificate.IPAddresses, ", "))
+			line("    ", "URIs", strings.Join(certificate.URIs, ", "))
+			line("    ", "x5t", certificate.ThumbprintSHA1)
+			line("    ", "x5t#S256", certificate.ThumbprintSHA256)
+		}
+	}
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(&b, "\nSkipped key %d [%s]: %s\n", skipped.Index, skipped.KeyID, skipped.Reason)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -1,18 +1,30 @@
 package ioutil
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 )
 
+const Stdio = "-"
+
+var stdinMutex sync.Mutex
+var stdinRead bool
+
 func LoadInputStr(filename string) string {
 	return string(LoadInput(filename))
 }
 
 func LoadInput(filename string) []byte {
 	log.Trace().Msgf("Reading file [%s] ...", filename)
-	inBytes, err := os.ReadFile(filename)
+	inBytes, err := readInput(filename)
 	if err != nil {
 		log.Fatal().Err(err).Msgf("Unable to read file %v", filename)
 	}
@@ -20,10 +32,104 @@ func LoadInput(filename string) []byte {
 	return inBytes
 }
 
+func readInput(filename string) ([]byte, error) {
+	switch {
+	case filename == Stdio:
+		stdin, err := OpenStdin()
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(filename, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(filename, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor [%s]", filename)
+		}
+		file := os.NewFile(uintptr(fd), filename)
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+	return os.ReadFile(filename)
+}
+
+func OpenStdin() (io.Reader, error) {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+	if stdinRead {
+		return nil, errors.New("stdin already read, only one input can come from stdin")
+	}
+	stdinRead = true
+	return os.Stdin, nil
+}
+
+func StdinPiped() bool {
+	return !IsTerminal(os.Stdin)
+}
+
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func WriteOutput(filename string, text string) {
+	writeFile(filename, []byte(text), true, 0666)
+}
+
+func WriteSecretOutput(filename string, text string) {
+	writeFile(filename, []byte(text), true, 0600)
+}
+
+func WriteData(filename string, data []byte) {
+	writeFile(filename, data, false, 0666)
+}
+
+func writeFile(filename string, data []byte, text bool, perm os.FileMode) {
+	if filename == Stdio {
+		if text && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			log.Fatal().Err(err).Msg("Unable to write to stdout")
+		}
+		return
+	}
 	log.Trace().Msgf("Writing file [%s] ...", filename)
-	if err := os.WriteFile(filename, []byte(text), 0666); err != nil {
+	if err := writeData(filename, data, perm); err != nil {
 		log.Fatal().Err(err).Msgf("Unable to write file %v", filename)
 	}
 	log.Info().Msgf("Writing to file [%s] completed with success.", filename)
 }
+
+func CreateSecretFile(filename string) (*os.File, error) {
+	return createFile(filename, 0600)
+}
+
+func writeData(filename string, data []byte, perm os.FileMode) error {
+	file, err := createFile(filename, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func createFile(filename string, perm os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+	if perm&0077 == 0 {
+		if err := file.Chmod(perm); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
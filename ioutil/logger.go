@@ -29,7 +29,7 @@ func InitLogger(params LogParameters) {
 	if logLevel == zerolog.TraceLevel {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	}
-	output := os.Stdout
+	output := os.Stderr
 	if params.File != nil {
 		output = params.File
 	}
@@ -0,0 +1,246 @@
+package key
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+
+	jose "github.com/go-jose/go-jose/v3"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	FormatPKCS1 = "pkcs1"
+	FormatPKCS8 = "pkcs8"
+	FormatSEC1  = "sec1"
+	FormatPKIX  = "pkix"
+	FormatJWK   = "jwk"
+	FormatJWKS  = "jwks"
+	FormatSSH   = "openssh"
+)
+
+type jwkSet struct {
+	Keys []json.RawMessage `json:"keys"`
+}
+
+func PublicKeyOf(key interface{}) (interface{}, error) {
+	if k, ok := key.(*ecdh.PrivateKey); ok {
+		return k.PublicKey(), nil
+	}
+	if _, ok := key.([]byte); ok {
+		return nil, fmt.Errorf("symmetric keys have no public half")
+	}
+	return keyutil.PublicKey(key)
+}
+
+func PublicFormat(format string) string {
+	switch format {
+	case FormatPKCS8, FormatSEC1:
+		return FormatPKIX
+	}
+	return format
+}
+
+func MarshalKey(jwk jose.JSONWebKey, format string) ([]byte, error) {
+	switch format {
+	case FormatJWK:
+		data, err := marshalJWK(jwk, nil)
+		if err != nil {
+			return nil, err
+		}
+		return indentJSON(data)
+	case FormatJWKS:
+		return MarshalJWKS([]jose.JSONWebKey{jwk})
+	}
+	if _, ok := jwk.Key.([]byte); ok {
+		return nil, fmt.Errorf("symmetric keys can only be written as %s|%s", FormatJWK, FormatJWKS)
+	}
+	if format == FormatSSH && jwk.IsPublic() {
+		sshKey, err := ssh.NewPublicKey(jwk.Key)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.MarshalAuthorizedKey(sshKey), nil
+	}
+	block, err := marshalPEMBlock(jwk.Key, format)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+func MarshalJWKS(keys []jose.JSONWebKey) ([]byte, error) {
+	set := jwkSet{Keys: []json.RawMessage{}}
+	for _, jwk := range keys {
+		data, err := marshalJWK(jwk, nil)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, data)
+	}
+	return json.MarshalIndent(set, "", "    ")
+}
+
+func (k JWKeyPair) JSONWebKey() jose.JSONWebKey {
+	jwk := jose.JSONWebKey{
+		Key:          k.PrivateKey,
+		KeyID:        k.KeyID,
+		Use:          k.Use,
+		Algorithm:    k.Algorithm,
+		Certificates: k.Certificates,
+	}
+	if jwk.Key == nil {
+		jwk.Key = k.PublicKey
+	}
+	if len(k.Certificates) > 0 {
+		jwk.CertificateThumbprintSHA1 = k.Thumbprint
+		jwk.CertificateThumbprintSHA256 = k.ThumbprintS256
+	}
+	return jwk
+}
+
+func MarshalKeyPairs(pairs []JWKeyPair, format string) ([]byte, error) {
+	switch format {
+	case FormatJWK:
+		if len(pairs) != 1 {
+			return nil, fmt.Errorf("format [%s] holds a single key, found %d, use %s", format, len(pairs), FormatJWKS)
+		}
+		data, err := marshalJWK(pairs[0].JSONWebKey(), pairs[0].KeyOps)
+		if err != nil {
+			return nil, err
+		}
+		return indentJSON(data)
+	case FormatJWKS:
+		set := jwkSet{Keys: []json.RawMessage{}}
+		for _, pair := range pairs {
+			data, err := marshalJWK(pair.JSONWebKey(), pair.KeyOps)
+			if err != nil {
+				return nil, err
+			}
+			set.Keys = append(set.Keys, data)
+		}
+		return json.MarshalIndent(set, "", "    ")
+	}
+	var out []byte
+	for _, pair := range pairs {
+		keyFormat := format
+		if pair.PrivateKey == nil {
+			keyFormat = PublicFormat(format)
+		}
+		data, err := MarshalKey(pair.JSONWebKey(), keyFormat)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+func MarshalDER(pair JWKeyPair, format string) ([]byte, error) {
+	switch format {
+	case FormatJWK, FormatJWKS, FormatSSH:
+		return nil, fmt.Errorf("format [%s] has no DER encoding", format)
+	}
+	key := pair.PrivateKey
+	if key == nil {
+		key = pair.PublicKey
+		format = PublicFormat(format)
+	}
+	if _, ok := key.([]byte); ok {
+		return nil, fmt.Errorf("symmetric keys can only be written as %s|%s", FormatJWK, FormatJWKS)
+	}
+	block, err := marshalPEMBlock(key, format)
+	if err != nil {
+		return nil, err
+	}
+	return block.Bytes, nil
+}
+
+func marshalPEMBlock(key interface{}, format string) (*pem.Block, error) {
+	switch format {
+	case FormatPKCS1:
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+		case *rsa.PublicKey:
+			return &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(k)}, nil
+		}
+		return nil, fmt.Errorf("format [%s] supports only RSA keys, found %T", format, key)
+	case FormatSEC1:
+		if k, ok := key.(*ecdsa.PrivateKey); ok {
+			der, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, err
+			}
+			return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+		}
+		return nil, fmt.Errorf("format [%s] supports only EC private keys, found %T", format, key)
+	case FormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+	case FormatSSH:
+		return pemutil.SerializeOpenSSHPrivateKey(key)
+	case FormatPKIX:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PUBLIC KEY", Bytes: der}, nil
+	}
+	return nil, fmt.Errorf("key format [%s] not supported, use %s|%s|%s|%s|%s|%s|%s", format,
+		FormatPKCS1, FormatPKCS8, FormatSEC1, FormatPKIX, FormatSSH, FormatJWK, FormatJWKS)
+}
+
+func marshalJWK(jwk jose.JSONWebKey, keyOps []string) ([]byte, error) {
+	var raw map[string]interface{}
+	switch k := jwk.Key.(type) {
+	case *ecdh.PrivateKey:
+		raw = map[string]interface{}{
+			"kty": "OKP",
+			"crv": "X25519",
+			"x":   base64.RawURLEncoding.EncodeToString(k.PublicKey().Bytes()),
+			"d":   base64.RawURLEncoding.EncodeToString(k.Bytes()),
+		}
+	case *ecdh.PublicKey:
+		raw = map[string]interface{}{
+			"kty": "OKP",
+			"crv": "X25519",
+			"x":   base64.RawURLEncoding.EncodeToString(k.Bytes()),
+		}
+	default:
+		data, err := jwk.MarshalJSON()
+		if err != nil || len(keyOps) == 0 {
+			return data, err
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range map[string]string{"kid": jwk.KeyID, "use": jwk.Use, "alg": jwk.Algorithm} {
+		if value != "" {
+			raw[name] = value
+		}
+	}
+	if len(keyOps) > 0 {
+		raw["key_ops"] = keyOps
+	}
+	return json.Marshal(raw)
+}
+
+func indentJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(v, "", "    ")
+}
@@ -0,0 +1,83 @@
+package key
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		options GenerateOptions
+		alg     jose.SignatureAlgorithm
+		formats []string
+	}{
+		{GenerateOptions{KeyType: "RSA"}, jose.RS256, []string{FormatPKCS1, FormatPKCS8, FormatSSH, FormatJWK, FormatJWKS}},
+		{GenerateOptions{KeyType: "EC", Curve: "P-256"}, jose.ES256, []string{FormatPKCS8, FormatSEC1, FormatSSH, FormatJWK, FormatJWKS}},
+		{GenerateOptions{KeyType: "EC", Curve: "P-384"}, jose.ES384, []string{FormatPKCS8, FormatSEC1, FormatJWK}},
+		{GenerateOptions{KeyType: "OKP", Curve: "Ed25519"}, jose.EdDSA, []string{FormatPKCS8, FormatSSH, FormatJWK, FormatJWKS}},
+		{GenerateOptions{KeyType: "oct"}, jose.HS256, []string{FormatJWK, FormatJWKS}},
+	} {
+		generated, err := GenerateKey(test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, format := range test.formats {
+			t.Run(fmt.Sprintf("%s%s/%s", test.options.KeyType, test.options.Curve, format), func(t *testing.T) {
+				testKeyRoundTrip(t, generated, test.alg, format)
+			})
+		}
+	}
+}
+
+func testKeyRoundTrip(t *testing.T, generated interface{}, alg jose.SignatureAlgorithm, format string) {
+	keygen, err := MarshalKey(jose.JSONWebKey{Key: generated, KeyID: "k1"}, format)
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	keySet, err := LoadKeySet(keygen, LoadOptions{})
+	if err != nil {
+		t.Fatalf("convert load: %v", err)
+	}
+	converted, err := MarshalKeyPairs(keySet.Keys, format)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+
+	privateKey, publicKey, err := LoadKeyPair(converted, LoadOptions{})
+	if err != nil {
+		t.Fatalf("load converted key: %v", err)
+	}
+	if keySet, ok := privateKey.(*KeySet); ok {
+		privateKey, publicKey = keySet.Keys[0].PrivateKey, keySet.Keys[0].PublicKey
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: privateKey}, nil)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	signed, err := signer.Sign([]byte(`{"sub":"round-trip"}`))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := signed.Verify(publicKey); err != nil {
+		t.Fatalf("verify with %T: %v", publicKey, err)
+	}
+
+	if _, symmetric := generated.([]byte); symmetric {
+		return
+	}
+	public, err := MarshalKey(jose.JSONWebKey{Key: publicKey}, PublicFormat(format))
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	if publicKey, err = LoadPublicKey(public, LoadOptions{}); err != nil {
+		t.Fatalf("load public key: %v", err)
+	}
+	if keySet, ok := publicKey.(*KeySet); ok {
+		publicKey = keySet.Keys[0].PublicKey
+	}
+	if _, err := signed.Verify(publicKey); err != nil {
+		t.Fatalf("verify with %s public key: %v", PublicFormat(format), err)
+	}
+}
@@ -0,0 +1,61 @@
+package key
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"go.step.sm/crypto/keyutil"
+)
+
+type GenerateOptions struct {
+	KeyType string
+	Curve   string
+	Size    int
+}
+
+func GenerateKey(options GenerateOptions) (interface{}, error) {
+
+	log.Debug().Msgf("Generating key with options: %+v", options)
+
+	switch options.KeyType {
+	case "RSA":
+		size := options.Size
+		if size == 0 {
+			size = 2048
+		}
+		return keyutil.GenerateKey("RSA", "", size)
+	case "EC":
+		curve := options.Curve
+		if curve == "" {
+			curve = "P-256"
+		}
+		return keyutil.GenerateKey("EC", curve, 0)
+	case "OKP":
+		switch options.Curve {
+		case "", "Ed25519":
+			return keyutil.GenerateKey("OKP", "Ed25519", 0)
+		case "X25519":
+			return ecdh.X25519().GenerateKey(rand.Reader)
+		default:
+			return nil, fmt.Errorf("OKP curve [%s] not supported, use Ed25519|X25519", options.Curve)
+		}
+	case "oct":
+		size := options.Size
+		if size == 0 {
+			size = 256
+		}
+		if size%8 != 0 {
+			return nil, errors.New("oct key size must be a multiple of 8 bits")
+		}
+		secret := make([]byte, size/8)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("key type [%s] not supported, use RSA|EC|OKP|oct", options.KeyType)
+	}
+}
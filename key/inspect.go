@@ -0,0 +1,183 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"go.step.sm/crypto/keyutil"
+	"golang.org/x/crypto/ssh"
+)
+
+type KeyInfo struct {
+	Name                 string            `json:"name,omitempty"`
+	Type                 string            `json:"kty"`
+	Size                 int               `json:"size,omitempty"`
+	Curve                string            `json:"crv,omitempty"`
+	Private              bool              `json:"private"`
+	KeyID                string            `json:"kid,omitempty"`
+	Use                  string            `json:"use,omitempty"`
+	Algorithm            string            `json:"alg,omitempty"`
+	KeyOps               []string          `json:"key_ops,omitempty"`
+	ThumbprintSHA1       string            `json:"thumbprint_sha1,omitempty"`
+	ThumbprintSHA256     string            `json:"thumbprint_sha256,omitempty"`
+	Certificates         []CertificateInfo `json:"certificates,omitempty"`
+	SigningAlgorithms    []string          `json:"jws_algorithms,omitempty"`
+	EncryptionAlgorithms []string          `json:"jwe_algorithms,omitempty"`
+}
+
+type CertificateInfo struct {
+	Subject          string    `json:"subject"`
+	Issuer           string    `json:"issuer"`
+	SerialNumber     string    `json:"serial"`
+	NotBefore        time.Time `json:"not_before"`
+	NotAfter         time.Time `json:"not_after"`
+	DNSNames         []string  `json:"dns_names,omitempty"`
+	EmailAddresses   []string  `json:"email_addresses,omitempty"`
+	IPAddresses      []string  `json:"ip_addresses,omitempty"`
+	URIs             []string  `json:"uris,omitempty"`
+	ThumbprintSHA1   string    `json:"x5t"`
+	ThumbprintSHA256 string    `json:"x5t#S256"`
+}
+
+func DetectFormat(data []byte) string {
+	if IsPKCS12(data) {
+		return "PKCS#12"
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		encrypted := ""
+		if x509.IsEncryptedPEMBlock(block) {
+			encrypted = " (encrypted)"
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return "PEM PKCS#1 private key" + encrypted
+		case "PRIVATE KEY":
+			return "PEM PKCS#8 private key"
+		case encryptedPKCS8Type:
+			return "PEM PKCS#8 private key (encrypted)"
+		case "EC PRIVATE KEY":
+			return "PEM SEC1 private key" + encrypted
+		case openSSHPrivateKeyType:
+			return "OpenSSH private key"
+		case "PUBLIC KEY":
+			return "PEM PKIX public key"
+		case "RSA PUBLIC KEY":
+			return "PEM PKCS#1 public key"
+		case "CERTIFICATE":
+			if certificates := parseCertificates(data); len(certificates) > 1 {
+				return fmt.Sprintf("PEM X.509 certificate chain (%d certificates)", len(certificates))
+			}
+			return "PEM X.509 certificate"
+		}
+		return "PEM " + block.Type
+	}
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var set struct {
+			Keys []json.RawMessage `json:"keys"`
+		}
+		if err := json.Unmarshal(trimmed, &set); err != nil {
+			return "JSON (invalid)"
+		}
+		if set.Keys != nil {
+			return "JWKS"
+		}
+		return "JWK"
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		return "OpenSSH public key"
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return "DER PKCS#1 private key"
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return "DER PKCS#8 private key"
+	}
+	if _, err := x509.ParseECPrivateKey(data); err == nil {
+		return "DER SEC1 private key"
+	}
+	if _, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return "DER PKIX public key"
+	}
+	if _, err := x509.ParsePKCS1PublicKey(data); err == nil {
+		return "DER PKCS#1 public key"
+	}
+	if _, err := x509.ParseCertificate(data); err == nil {
+		return "DER X.509 certificate"
+	}
+	return "unknown"
+}
+
+func Describe(pair JWKeyPair) KeyInfo {
+	info := KeyInfo{
+		Name:      pair.Name,
+		Private:   pair.PrivateKey != nil,
+		KeyID:     pair.KeyID,
+		Use:       pair.Use,
+		Algorithm: pair.Algorithm,
+		KeyOps:    pair.KeyOps,
+	}
+	publicKey := pair.PublicKey
+	if k, err := keyutil.PublicKey(publicKey); err == nil {
+		publicKey = k
+	}
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		info.Type, info.Size = "RSA", k.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Type, info.Size, info.Curve = "EC", k.Curve.Params().BitSize, k.Curve.Params().Name
+	case ed25519.PublicKey:
+		info.Type, info.Size, info.Curve = "OKP", 256, "Ed25519"
+	case *ecdh.PublicKey:
+		info.Type, info.Size, info.Curve = "OKP", 256, "X25519"
+	case []byte:
+		info.Type, info.Size = "oct", len(k)*8
+	default:
+		info.Type = fmt.Sprintf("%T", k)
+	}
+	if thumbprint, err := Thumbprint(pair.PublicKey, crypto.SHA1); err == nil {
+		info.ThumbprintSHA1 = thumbprint
+	}
+	if thumbprint, err := Thumbprint(pair.PublicKey, crypto.SHA256); err == nil {
+		info.ThumbprintSHA256 = thumbprint
+	}
+	for _, certificate := range pair.Certificates {
+		info.Certificates = append(info.Certificates, describeCertificate(certificate))
+	}
+	return info
+}
+
+func describeCertificate(certificate *x509.Certificate) CertificateInfo {
+	sha1Sum := sha1.Sum(certificate.Raw)
+	sha256Sum := sha256.Sum256(certificate.Raw)
+	info := CertificateInfo{
+		Subject:          certificate.Subject.String(),
+		Issuer:           certificate.Issuer.String(),
+		SerialNumber:     hex.EncodeToString(certificate.SerialNumber.Bytes()),
+		NotBefore:        certificate.NotBefore,
+		NotAfter:         certificate.NotAfter,
+		DNSNames:         certificate.DNSNames,
+		EmailAddresses:   certificate.EmailAddresses,
+		ThumbprintSHA1:   base64.RawURLEncoding.EncodeToString(sha1Sum[:]),
+		ThumbprintSHA256: base64.RawURLEncoding.EncodeToString(sha256Sum[:]),
+	}
+	for _, ip := range certificate.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	return info
+}
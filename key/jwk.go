@@ -1,10 +1,11 @@
 package key
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"reflect"
 
 	jose "github.com/go-jose/go-jose/v3"
 	"github.com/rs/zerolog/log"
@@ -12,95 +13,124 @@ import (
 )
 
 type JWKeyPair struct {
-	PrivateKey interface{}
-	PublicKey  interface{}
+	PrivateKey     interface{}
+	PublicKey      interface{}
+	KeyID          string
+	Use            string
+	Algorithm      string
+	Thumbprint     []byte
+	ThumbprintS256 []byte
+	Name           string
+	Certificates   []*x509.Certificate
+	KeyOps         []string
 }
 
-func mapKey(jwk jose.JSONWebKey, pub bool) *JWKeyPair {
-	if jwk.Valid() && jwk.IsPublic() == pub {
-		log.Trace().Msgf("Found valid JSONWebKey [%s]", jwk.KeyID)
-		if jwk.IsPublic() {
-			return &JWKeyPair{
-				PublicKey: jwk.Public().Key,
-			}
+func mapKey(jwk jose.JSONWebKey, pub bool) (*JWKeyPair, error) {
+	pair := &JWKeyPair{
+		KeyID:          jwk.KeyID,
+		Use:            jwk.Use,
+		Algorithm:      jwk.Algorithm,
+		Thumbprint:     jwk.CertificateThumbprintSHA1,
+		ThumbprintS256: jwk.CertificateThumbprintSHA256,
+		Certificates:   jwk.Certificates,
+	}
+	if len(jwk.Certificates) > 0 {
+		if len(pair.Thumbprint) == 0 {
+			sum := sha1.Sum(jwk.Certificates[0].Raw)
+			pair.Thumbprint = sum[:]
 		}
-		return &JWKeyPair{
-			PrivateKey: jwk.Key,
-			PublicKey:  jwk.Public().Key,
+		if len(pair.ThumbprintS256) == 0 {
+			sum := sha256.Sum256(jwk.Certificates[0].Raw)
+			pair.ThumbprintS256 = sum[:]
 		}
-	} else {
+	}
+	if secret, ok := jwk.Key.([]byte); ok {
+		if len(secret) == 0 {
+			return pair, errors.New("empty symmetric key")
+		}
+		log.Trace().Msgf("Found symmetric JSONWebKey [%s]", jwk.KeyID)
+		pair.PrivateKey = secret
+		pair.PublicKey = secret
+		return pair, nil
+	}
+	if !jwk.Valid() {
 		log.Trace().Msgf("jsonWebKey [%s] not valid ", jwk.KeyID)
+		return pair, errors.New("invalid key")
 	}
-	return nil
+	if jwk.IsPublic() != pub {
+		if pub {
+			return pair, errors.New("private key where a public key is expected")
+		}
+		return pair, errors.New("public key where a private key is expected")
+	}
+	log.Trace().Msgf("Found valid JSONWebKey [%s]", jwk.KeyID)
+	pair.PublicKey = jwk.Public().Key
+	if !jwk.IsPublic() {
+		pair.PrivateKey = jwk.Key
+	}
+	return pair, nil
 }
 
 func ResolveKeyPair(key interface{}, pub bool, kid string) (interface{}, interface{}, error) {
-	if reflect.ValueOf(key).Kind() == reflect.Map {
-		keyMap, valid := key.(map[string]JWKeyPair)
-		if !valid {
-			return nil, nil, errors.New("invalid JsokWebKey")
-		}
-		if kid != "" {
-			log.Trace().Msgf("jsonWebKeySet: %#v", kid)
-			if key, ok := keyMap[kid]; ok {
-				log.Trace().Msgf("jsonWebKey matched %s", kid)
-				return key.PrivateKey, key.PublicKey, nil
-			} else {
-				return nil, nil, fmt.Errorf("jsonWebKey [%s] not found", kid)
-			}
-		}
-		if len(keyMap) == 0 {
-			return nil, nil, errors.New("JsonWebKey empty")
-		} else if len(keyMap) > 1 {
-			return nil, nil, errors.New("multiple JsonWebKey found")
-		}
-		var key JWKeyPair
-		for _, k := range keyMap {
-			key = k
-			break
-		}
-		log.Trace().Msgf("JWKeyPair: %#v", key)
-		return key.PrivateKey, key.PublicKey, nil
-	} else {
-		if pub {
-			return nil, key, nil
+	switch k := key.(type) {
+	case *RemoteKeySet:
+		return k.resolve(pub, kid)
+	case *KeySet:
+		pair, err := k.Resolve(kid)
+		if err != nil {
+			return nil, nil, err
 		}
-		if publicKey, err := keyutil.PublicKey(key); err == nil {
-			log.Debug().Msg("Extracted PublicKey from PKCS8PrivateKey")
-			return key, publicKey, nil
-		}
-		return key, nil, nil
+		return pair.PrivateKey, pair.PublicKey, nil
+	}
+	if pub {
+		return nil, key, nil
+	}
+	if publicKey, err := keyutil.PublicKey(key); err == nil {
+		log.Debug().Msg("Extracted PublicKey from PKCS8PrivateKey")
+		return key, publicKey, nil
 	}
+	return key, nil, nil
+}
+
+func LoadJSONWebKey(json []byte, pub bool) (*KeySet, error) {
+	return loadJSONWebKey(json, func(jwk jose.JSONWebKey) (*JWKeyPair, error) {
+		return mapKey(jwk, pub)
+	})
 }
 
-func LoadJSONWebKey(json []byte, pub bool) (map[string]JWKeyPair, error) {
+func LoadJSONWebKeySet(jwkBytes []byte, pub bool) (*KeySet, error) {
+	return loadJSONWebKeySet(jwkBytes, func(jwk jose.JSONWebKey) (*JWKeyPair, error) {
+		return mapKey(jwk, pub)
+	})
+}
+
+func loadAnyJSONWebKey(json []byte) (*KeySet, error) {
+	return loadJSONWebKey(json, func(jwk jose.JSONWebKey) (*JWKeyPair, error) {
+		return mapKey(jwk, jwk.IsPublic())
+	})
+}
+
+func loadJSONWebKey(json []byte, mapper func(jose.JSONWebKey) (*JWKeyPair, error)) (*KeySet, error) {
 	var jwk jose.JSONWebKey
-	var jwkMap = make(map[string]JWKeyPair)
 
 	log.Debug().Msg("Testing for Single JsonWebKey ...")
 	err := jwk.UnmarshalJSON(json)
 	if err != nil {
 		log.Trace().Err(err).Send()
-		if jwks, err := LoadJSONWebKeySet(json); err != nil {
-			return nil, err
-		} else {
-			for _, k := range jwks {
-				if key := mapKey(k, pub); key != nil {
-					jwkMap[k.KeyID] = *key
-				}
-			}
-		}
-	} else {
-		log.Debug().Msg("Found JsonWebKey")
-		if key := mapKey(jwk, pub); key != nil {
-			jwkMap[jwk.KeyID] = *key
-		}
+		return loadJSONWebKeySet(json, mapper)
 	}
-	return jwkMap, nil
+	log.Debug().Msg("Found JsonWebKey")
+	keySet := &KeySet{}
+	pair, err := mapper(jwk)
+	pair.KeyOps = keyOps(json)
+	keySet.add(0, pair, err)
+	return keySet, nil
 }
 
-func LoadJSONWebKeySet(jwkBytes []byte) ([]jose.JSONWebKey, error) {
-	var jwkSet jose.JSONWebKeySet
+func loadJSONWebKeySet(jwkBytes []byte, mapper func(jose.JSONWebKey) (*JWKeyPair, error)) (*KeySet, error) {
+	var jwkSet struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
 
 	log.Debug().Msg("Testing for JsonWebKeySet ...")
 	err := json.Unmarshal(jwkBytes, &jwkSet)
@@ -108,11 +138,43 @@ func LoadJSONWebKeySet(jwkBytes []byte) ([]jose.JSONWebKey, error) {
 		log.Trace().Err(err).Send()
 		return nil, errors.New("error parsing jwk key set")
 	}
-	keys := jwkSet.Keys
-	if len(keys) > 0 {
-		log.Debug().Msg("Found JsonWebKeySet")
-		return keys, nil
-	} else {
+	if len(jwkSet.Keys) == 0 {
 		return nil, errors.New("no keys found in jwk")
 	}
+	log.Debug().Msg("Found JsonWebKeySet")
+	keySet := &KeySet{}
+	for i, raw := range jwkSet.Keys {
+		var jwk jose.JSONWebKey
+		if err := jwk.UnmarshalJSON(raw); err != nil {
+			var header struct {
+				KeyID string `json:"kid"`
+			}
+			_ = json.Unmarshal(raw, &header)
+			keySet.add(i, &JWKeyPair{KeyID: header.KeyID}, err)
+			continue
+		}
+		pair, err := mapper(jwk)
+		pair.KeyOps = keyOps(raw)
+		keySet.add(i, pair, err)
+	}
+	return keySet, nil
+}
+
+func keyOps(raw []byte) []string {
+	var header struct {
+		KeyOps []string `json:"key_ops"`
+	}
+	_ = json.Unmarshal(raw, &header)
+	return header.KeyOps
+}
+
+func ResolvePair(key interface{}, pub bool, kid string) (*JWKeyPair, error) {
+	if keySet, ok := key.(*KeySet); ok {
+		return keySet.Resolve(kid)
+	}
+	privateKey, publicKey, err := ResolveKeyPair(key, pub, kid)
+	if err != nil {
+		return nil, err
+	}
+	return &JWKeyPair{PrivateKey: privateKey, PublicKey: publicKey, KeyID: kid}, nil
 }
@@ -0,0 +1,156 @@
+package key
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type KeySet struct {
+	Keys    []JWKeyPair
+	Skipped []SkippedKey
+}
+
+type SkippedKey struct {
+	Index  int    `json:"index"`
+	KeyID  string `json:"kid,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (s *KeySet) Len() int {
+	return len(s.Keys)
+}
+
+func (s *KeySet) add(index int, pair *JWKeyPair, err error) {
+	if err != nil {
+		log.Warn().Msgf("jsonWebKey %d [%s] skipped: %v", index, pair.KeyID, err)
+		s.Skipped = append(s.Skipped, SkippedKey{Index: index, KeyID: pair.KeyID, Reason: err.Error()})
+		return
+	}
+	s.Keys = append(s.Keys, *pair)
+}
+
+func (s *KeySet) filter(match func(JWKeyPair) bool) []JWKeyPair {
+	var keys []JWKeyPair
+	for _, k := range s.Keys {
+		if match(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *KeySet) ByKeyID(kid string) []JWKeyPair {
+	return s.filter(func(k JWKeyPair) bool {
+		return k.KeyID == kid
+	})
+}
+
+func (s *KeySet) ByThumbprint(thumbprint string) []JWKeyPair {
+	return s.filter(func(k JWKeyPair) bool {
+		return k.HasThumbprint(thumbprint)
+	})
+}
+
+func (s *KeySet) ByUse(use string) []JWKeyPair {
+	return s.filter(func(k JWKeyPair) bool {
+		return k.Usable(use, "")
+	})
+}
+
+func (s *KeySet) ByAlgorithm(alg string) []JWKeyPair {
+	return s.filter(func(k JWKeyPair) bool {
+		return k.Usable("", alg)
+	})
+}
+
+func (s *KeySet) Resolve(kid string) (*JWKeyPair, error) {
+	keys := s.Keys
+	if kid != "" {
+		log.Trace().Msgf("jsonWebKeySet: %#v", kid)
+		keys = s.ByKeyID(kid)
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("jsonWebKey [%s] not found", kid)
+		}
+	}
+	switch len(keys) {
+	case 0:
+		return nil, s.emptyError()
+	case 1:
+		log.Trace().Msgf("JWKeyPair [%s] %T", keys[0].KeyID, keys[0].PublicKey)
+		return &keys[0], nil
+	}
+	if kid != "" {
+		return nil, fmt.Errorf("multiple JsonWebKey found with kid [%s]", kid)
+	}
+	return nil, fmt.Errorf("multiple JsonWebKey found, select one with kid: %s", strings.Join(s.keyIDs(), ", "))
+}
+
+func (s *KeySet) emptyError() error {
+	if len(s.Skipped) == 0 {
+		return errors.New("JsonWebKey empty")
+	}
+	reasons := make([]string, 0, len(s.Skipped))
+	for _, skipped := range s.Skipped {
+		reasons = append(reasons, fmt.Sprintf("key %d [%s]: %s", skipped.Index, skipped.KeyID, skipped.Reason))
+	}
+	return fmt.Errorf("JsonWebKey empty, skipped %s", strings.Join(reasons, "; "))
+}
+
+func (s *KeySet) keyIDs() []string {
+	kids := make([]string, 0, len(s.Keys))
+	for i, k := range s.Keys {
+		if k.KeyID == "" && k.Name != "" {
+			kids = append(kids, fmt.Sprintf("<key %d alias %s>", i, k.Name))
+		} else if k.KeyID == "" {
+			kids = append(kids, fmt.Sprintf("<key %d without kid>", i))
+		} else {
+			kids = append(kids, k.KeyID)
+		}
+	}
+	return kids
+}
+
+func LoadKeySet(data []byte, options LoadOptions) (*KeySet, error) {
+	if IsPKCS12(data) {
+		log.Debug().Msg("Found PKCS12")
+		return LoadPKCS12(data, options)
+	}
+	if certificates := parseCertificates(data); len(certificates) > 0 {
+		log.Debug().Msgf("Found %d Certificates", len(certificates))
+		return certificateKeySet(certificates), nil
+	}
+	if input, err := ReadKey(data, LoadOptions{}); err == nil {
+		if keySet, err := loadAnyJSONWebKey(input); err == nil {
+			if keySet.Len() == 0 {
+				return nil, keySet.emptyError()
+			}
+			return keySet, nil
+		}
+	}
+
+	privateKey, publicKey, err := LoadKeyPair(data, options)
+	if err != nil {
+		if !errors.Is(err, errInvalidPrivateKey) {
+			return nil, err
+		}
+		log.Trace().Err(err).Send()
+		if publicKey, err = LoadPublicKey(data, options); err != nil {
+			return nil, errors.New("parse error, invalid key")
+		}
+	}
+	if keySet, ok := publicKey.(*KeySet); ok {
+		return keySet, nil
+	}
+	keySet := &KeySet{}
+	keySet.add(0, &JWKeyPair{PrivateKey: privateKey, PublicKey: publicKey}, nil)
+	return keySet, nil
+}
+
+func certificateKeySet(certificates []*x509.Certificate) *KeySet {
+	pair := CertificateKeyPair(certificateChain(certificates[0], certificates))
+	return &KeySet{Keys: []JWKeyPair{pair}}
+}
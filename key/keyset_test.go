@@ -0,0 +1,119 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testKeyPair(t *testing.T, kid string) JWKeyPair {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return JWKeyPair{PrivateKey: privateKey, PublicKey: &privateKey.PublicKey, KeyID: kid}
+}
+
+func testCertificateKeyPair(t *testing.T, kid string) (JWKeyPair, *x509.Certificate) {
+	t.Helper()
+	pair := testKeyPair(t, kid)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: kid},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pair.PublicKey, pair.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPair := CertificateKeyPair([]*x509.Certificate{certificate})
+	certPair.KeyID = kid
+	return certPair, certificate
+}
+
+func kids(keys []JWKeyPair) []string {
+	var ids []string
+	for _, pair := range keys {
+		ids = append(ids, pair.KeyID)
+	}
+	return ids
+}
+
+func TestKeySetByThumbprint(t *testing.T) {
+	plain := testKeyPair(t, "plain")
+	certPair, certificate := testCertificateKeyPair(t, "cert")
+	keys := &KeySet{Keys: []JWKeyPair{plain, certPair}}
+
+	rfc7638, err := Thumbprint(plain.PublicKey, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1Sum := sha1.Sum(certificate.Raw)
+	sha256Sum := sha256.Sum256(certificate.Raw)
+	for _, test := range []struct {
+		name       string
+		thumbprint string
+		want       string
+	}{
+		{"RFC 7638", rfc7638, "plain"},
+		{"x5t", base64.RawURLEncoding.EncodeToString(sha1Sum[:]), "cert"},
+		{"x5t#S256", base64.RawURLEncoding.EncodeToString(sha256Sum[:]), "cert"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			found := keys.ByThumbprint(test.thumbprint)
+			if len(found) != 1 || found[0].KeyID != test.want {
+				t.Fatalf("ByThumbprint(%s) = %v, want [%s]", test.thumbprint, kids(found), test.want)
+			}
+		})
+	}
+	if found := keys.ByThumbprint("unknown"); len(found) != 0 {
+		t.Fatalf("ByThumbprint(unknown) = %v", kids(found))
+	}
+	if found := keys.ByThumbprint(""); len(found) != 0 {
+		t.Fatalf("ByThumbprint(\"\") = %v", kids(found))
+	}
+}
+
+func TestSelectKeysHintOrder(t *testing.T) {
+	other := testKeyPair(t, "other")
+	certPair, certificate := testCertificateKeyPair(t, "cert")
+	named := testKeyPair(t, "named")
+	keys := &KeySet{Keys: []JWKeyPair{other, certPair, named}}
+	sha1Sum := sha1.Sum(certificate.Raw)
+	sha256Sum := sha256.Sum256(certificate.Raw)
+
+	candidates, err := SelectKeys(keys, true, "", KeyHint{
+		KeyID:       "named",
+		Thumbprints: []string{base64.RawURLEncoding.EncodeToString(sha256Sum[:]), base64.RawURLEncoding.EncodeToString(sha1Sum[:])},
+		Algorithm:   "ES256",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kids(candidates); len(got) != 3 || got[0] != "named" || got[1] != "cert" || got[2] != "other" {
+		t.Fatalf("candidates = %v, want [named cert other]", got)
+	}
+
+	candidates, err = SelectKeys(keys, true, "", KeyHint{KeyID: "cert", Thumbprints: []string{base64.RawURLEncoding.EncodeToString(sha1Sum[:])}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kids(candidates); len(got) != 3 || got[0] != "cert" {
+		t.Fatalf("candidates = %v, want cert once and first", got)
+	}
+}
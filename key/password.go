@@ -0,0 +1,141 @@
+package key
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/ioutil"
+	"golang.org/x/term"
+)
+
+type PasswordFunc func(prompt string) ([]byte, error)
+
+var stdinPassword = readOnce(func() ([]byte, error) {
+	stdin, err := ioutil.OpenStdin()
+	if err != nil {
+		return nil, err
+	}
+	return readLine(stdin)
+})
+
+type LoadOptions struct {
+	CheckForPassword bool
+	Password         PasswordFunc
+	Alias            string
+}
+
+func (o LoadOptions) password(prompt string) ([]byte, error) {
+	if o.Password == nil {
+		return TerminalPassword(prompt)
+	}
+	return o.Password(prompt)
+}
+
+func TerminalPassword(prompt string) ([]byte, error) {
+	fd := int(syscall.Stdin)
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("no terminal to read the password from, use a password source")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return password, err
+}
+
+func PasswordSource(source string) (PasswordFunc, error) {
+	name, value, _ := strings.Cut(source, ":")
+	switch name {
+	case "", "prompt":
+		return TerminalPassword, nil
+	case "env":
+		return func(string) ([]byte, error) {
+			password, ok := os.LookupEnv(value)
+			if !ok {
+				return nil, fmt.Errorf("password environment variable %s not set", value)
+			}
+			return []byte(password), nil
+		}, nil
+	case "file":
+		return func(string) ([]byte, error) {
+			data, err := os.ReadFile(value)
+			if err != nil {
+				return nil, err
+			}
+			return firstLine(data), nil
+		}, nil
+	case "fd":
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid password file descriptor [%s]", value)
+		}
+		return readOnce(func() ([]byte, error) {
+			file := os.NewFile(uintptr(fd), "fd:"+value)
+			defer file.Close()
+			return readLine(file)
+		}), nil
+	case "stdin":
+		return stdinPassword, nil
+	case "askpass":
+		command := value
+		if command == "" {
+			command = askpassCommand()
+		}
+		if command == "" {
+			return nil, errors.New("askpass command not set, use askpass:<command>, JWE_ASKPASS or SSH_ASKPASS")
+		}
+		return func(prompt string) ([]byte, error) {
+			log.Debug().Msgf("Running askpass command %s ...", command)
+			cmd := exec.Command(command, prompt)
+			cmd.Stderr = os.Stderr
+			output, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("askpass command %s failed: %w", command, err)
+			}
+			return firstLine(output), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown password source [%s], use env:<VAR>|file:<path>|fd:<N>|stdin|askpass[:<command>]|prompt", name)
+	}
+}
+
+func askpassCommand() string {
+	if command := os.Getenv("JWE_ASKPASS"); command != "" {
+		return command
+	}
+	return os.Getenv("SSH_ASKPASS")
+}
+
+func readOnce(read func() ([]byte, error)) PasswordFunc {
+	var once sync.Once
+	var password []byte
+	var err error
+	return func(string) ([]byte, error) {
+		once.Do(func() {
+			password, err = read()
+		})
+		return password, err
+	}
+}
+
+func readLine(reader io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return firstLine([]byte(line)), err
+}
+
+func firstLine(data []byte) []byte {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
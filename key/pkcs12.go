@@ -0,0 +1,153 @@
+package key
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.step.sm/crypto/keyutil"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+type pfxHeader struct {
+	Version  int
+	AuthSafe asn1.RawValue
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+func IsPKCS12(data []byte) bool {
+	var header pfxHeader
+	rest, err := asn1.Unmarshal(data, &header)
+	return err == nil && len(rest) == 0 && header.Version == 3
+}
+
+func LoadPKCS12(data []byte, options LoadOptions) (*KeySet, error) {
+	password := ""
+	if options.CheckForPassword {
+		passwordBytes, err := options.password("Password (PKCS12): ")
+		if err != nil {
+			return nil, fmt.Errorf("reading password: %w", err)
+		}
+		password = string(passwordBytes)
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyBlocks []*pem.Block
+	var certificates []*x509.Certificate
+	certificateHeaders := make(map[*x509.Certificate]map[string]string)
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certificates = append(certificates, certificate)
+			certificateHeaders[certificate] = block.Headers
+		default:
+			keyBlocks = append(keyBlocks, block)
+		}
+	}
+
+	keySet := &KeySet{}
+	for i, block := range keyBlocks {
+		pair := &JWKeyPair{Name: block.Headers["friendlyName"]}
+		if options.Alias != "" && !strings.EqualFold(pair.Name, options.Alias) {
+			log.Debug().Msgf("PKCS12 entry [%s] skipped, alias %s requested", pair.Name, options.Alias)
+			continue
+		}
+		privateKey, err := parsePKCS12Key(block.Bytes)
+		if err == nil {
+			pair.PrivateKey = privateKey
+			pair.PublicKey, err = keyutil.PublicKey(privateKey)
+		}
+		if err == nil {
+			for _, certificate := range certificates {
+				if publicKey, ok := pair.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && publicKey.Equal(certificate.PublicKey) {
+					pair.setCertificates(certificateChain(certificate, certificates))
+					break
+				}
+			}
+		}
+		keySet.add(i, pair, err)
+	}
+	if keySet.Len() == 0 && len(keyBlocks) == 0 && len(certificates) > 0 {
+		log.Debug().Msg("PKCS12 has no private keys, using certificates")
+		for i, certificate := range certificates {
+			pair := CertificateKeyPair(certificateChain(certificate, certificates))
+			pair.Name = certificateHeaders[certificate]["friendlyName"]
+			if options.Alias == "" || strings.EqualFold(pair.Name, options.Alias) {
+				keySet.add(i, &pair, nil)
+			}
+		}
+	}
+	if keySet.Len() == 0 {
+		if options.Alias != "" {
+			return nil, fmt.Errorf("PKCS12 entry [%s] not found", options.Alias)
+		}
+		return nil, keySet.emptyError()
+	}
+	log.Debug().Msgf("Found PKCS12 with %d entries", keySet.Len())
+	return keySet, nil
+}
+
+func parsePKCS12Key(der []byte) (interface{}, error) {
+	if privateKey, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return privateKey, nil
+	}
+	if privateKey, err := x509.ParseECPrivateKey(der); err == nil {
+		return privateKey, nil
+	}
+	if privateKey, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return privateKey, nil
+	}
+	return nil, errors.New("unsupported PKCS12 private key")
+}
+
+func certificateChain(leaf *x509.Certificate, certificates []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{leaf}
+	for current := leaf; !bytes.Equal(current.RawIssuer, current.RawSubject) && len(chain) <= len(certificates); {
+		var issuer *x509.Certificate
+		for _, certificate := range certificates {
+			if bytes.Equal(certificate.RawSubject, current.RawIssuer) && current.CheckSignatureFrom(certificate) == nil {
+				issuer = certificate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+	return chain
+}
+
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			return nil
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		certificates = append(certificates, certificate)
+	}
+	if certificates == nil {
+		if certificate, err := x509.ParseCertificate(data); err == nil {
+			certificates = append(certificates, certificate)
+		}
+	}
+	return certificates
+}
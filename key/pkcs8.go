@@ -0,0 +1,25 @@
+package key
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"go.step.sm/crypto/pemutil"
+)
+
+func MarshalEncryptedKey(key interface{}, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("empty password")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := pemutil.EncryptPKCS8PrivateKey(rand.Reader, der, password, x509.PEMCipherAES256)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
@@ -5,45 +5,58 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"syscall"
 
 	"github.com/rs/zerolog/log"
 	"go.step.sm/crypto/keyutil"
-
-	"golang.org/x/term"
+	"go.step.sm/crypto/pemutil"
 )
 
-func ReadPassword() []byte {
-	fmt.Print("Password: ")
-	bytepw, err := term.ReadPassword(int(syscall.Stdin))
-	if err != nil {
-		log.Panic().Err(err).Send()
-	}
-	return bytepw
-}
+var errInvalidPrivateKey = errors.New("parse error, invalid private key")
+
+const (
+	encryptedPKCS8Type    = "ENCRYPTED PRIVATE KEY"
+	openSSHPrivateKeyType = "OPENSSH PRIVATE KEY"
+)
 
-func ReadKey(payload []byte, checkForPassword bool) []byte {
-	var err error
+func ReadKey(payload []byte, options LoadOptions) ([]byte, error) {
 	block, _ := pem.Decode(payload)
 	if block != nil {
 		log.Trace().Msgf("Found PEM Block %s: %+v", block.Type, block.Headers)
 		payload = block.Bytes
-		if checkForPassword && x509.IsEncryptedPEMBlock(block) {
+		if options.CheckForPassword && (x509.IsEncryptedPEMBlock(block) || block.Type == encryptedPKCS8Type) {
 			log.Trace().Msg("Found Password Protected Block")
-			password := ReadPassword()
-			if payload, err = x509.DecryptPEMBlock(block, password); err != nil {
-				log.Fatal().Err(err).Msg("Decrypt failed")
+			password, err := options.password(fmt.Sprintf("Password (%s): ", block.Type))
+			if err != nil {
+				return nil, fmt.Errorf("reading password: %w", err)
+			}
+			if payload, err = pemutil.DecryptPEMBlock(block, password); err != nil {
+				return nil, fmt.Errorf("decrypt failed: %w", err)
 			}
 			log.Debug().Msg("Decrypted PEM Key with success.")
 		}
 		log.Debug().Msg("Decoded PEM Block with success.")
 	}
-	return payload
+	return payload, nil
 }
 
-func LoadKeyPair(data []byte, checkForPassword bool) (interface{}, interface{}, error) {
+func LoadKeyPair(data []byte, options LoadOptions) (interface{}, interface{}, error) {
 
-	input := ReadKey(data, checkForPassword)
+	if block, _ := pem.Decode(data); block != nil && block.Type == openSSHPrivateKeyType {
+		return loadOpenSSHKey(data, options)
+	}
+	if IsPKCS12(data) {
+		log.Debug().Msg("Found PKCS12")
+		keySet, err := LoadPKCS12(data, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		return keySet, keySet, nil
+	}
+
+	input, err := ReadKey(data, options)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	log.Debug().Msg("Testing for PKCS1PrivateKey ...")
 	if privateKey, err := x509.ParsePKCS1PrivateKey(input); err == nil {
@@ -67,13 +80,17 @@ func LoadKeyPair(data []byte, checkForPassword bool) (interface{}, interface{},
 	log.Debug().Msg("Testing for ECPrivateKey ...")
 	if privateKey, err := x509.ParseECPrivateKey(input); err == nil {
 		log.Debug().Msg("Found ECPrivateKey")
-		return privateKey, privateKey.PublicKey, nil
+		return privateKey, &privateKey.PublicKey, nil
 	} else {
 		log.Trace().Err(err).Send()
 	}
 
 	log.Debug().Msg("Testing for JsonWebKey ...")
 	if jsonWebKey, err := LoadJSONWebKey(input, false); err == nil {
+		if jsonWebKey.Len() > 1 {
+			log.Debug().Msgf("Found JsonWebKeySet with %d keys", jsonWebKey.Len())
+			return jsonWebKey, jsonWebKey, nil
+		}
 		if privateKey, publicKey, err := ResolveKeyPair(jsonWebKey, false, ""); err == nil {
 			log.Debug().Msg("Found JsonWebKey")
 			return privateKey, publicKey, nil
@@ -84,10 +101,28 @@ func LoadKeyPair(data []byte, checkForPassword bool) (interface{}, interface{},
 		log.Trace().Err(err).Send()
 	}
 
-	return nil, nil, errors.New("parse error, invalid private key")
+	return nil, nil, errInvalidPrivateKey
+}
+
+func loadOpenSSHKey(data []byte, options LoadOptions) (interface{}, interface{}, error) {
+	log.Debug().Msg("Testing for OpenSSHPrivateKey ...")
+	opts := []pemutil.Options{}
+	if options.CheckForPassword {
+		opts = append(opts, pemutil.WithPasswordPrompt("Password (OPENSSH PRIVATE KEY): ", pemutil.PasswordPrompter(options.password)))
+	}
+	privateKey, err := pemutil.ParseOpenSSHPrivateKey(data, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := keyutil.PublicKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debug().Msg("Found OpenSSHPrivateKey")
+	return privateKey, publicKey, nil
 }
 
-func LoadPrivateKey(data []byte, checkForPassword bool) (interface{}, error) {
-	privateKey, _, err := LoadKeyPair(data, checkForPassword)
+func LoadPrivateKey(data []byte, options LoadOptions) (interface{}, error) {
+	privateKey, _, err := LoadKeyPair(data, options)
 	return privateKey, err
 }
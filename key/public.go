@@ -6,9 +6,15 @@ import (
 	"errors"
 
 	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
 )
 
-func LoadPublicKey(data []byte, checkForPassword bool) (interface{}, error) {
+func LoadPublicKey(data []byte, options LoadOptions) (interface{}, error) {
+
+	if IsPKCS12(data) {
+		log.Debug().Msg("Found PKCS12")
+		return LoadPKCS12(data, options)
+	}
 
 	input := []byte(data)
 	block, _ := pem.Decode(input)
@@ -32,16 +38,33 @@ func LoadPublicKey(data []byte, checkForPassword bool) (interface{}, error) {
 		log.Trace().Err(err).Send()
 	}
 
+	log.Debug().Msg("Testing for PKCS1PublicKey ...")
+	if publicKey, err := x509.ParsePKCS1PublicKey(input); err == nil {
+		log.Debug().Msg("Found PKCS1PublicKey")
+		return publicKey, nil
+	} else {
+		log.Trace().Err(err).Send()
+	}
+
 	log.Debug().Msg("Testing for Certificate ...")
-	if certificate, err := x509.ParseCertificate(input); err == nil {
-		log.Debug().Msg("Found PublicKey from Certificate")
-		return certificate.PublicKey, nil
+	if certificates := parseCertificates(data); len(certificates) > 0 {
+		log.Debug().Msgf("Found PublicKey from Certificate (chain of %d)", len(certificates))
+		return certificateKeySet(certificates), nil
+	}
+
+	log.Debug().Msg("Testing for OpenSSH PublicKey ...")
+	if sshKey, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		if cryptoKey, ok := sshKey.(ssh.CryptoPublicKey); ok {
+			log.Debug().Msg("Found OpenSSH PublicKey")
+			return cryptoKey.CryptoPublicKey(), nil
+		}
+		log.Trace().Msgf("OpenSSH key type %s not supported", sshKey.Type())
 	} else {
 		log.Trace().Err(err).Send()
 	}
 
 	log.Debug().Msg("Testing for PrivateKey ...")
-	if _, publicKey, err := LoadKeyPair(input, checkForPassword); err == nil {
+	if _, publicKey, err := LoadKeyPair(data, options); err == nil {
 		log.Debug().Msg("Found PublicKey From PrivateKey")
 		return publicKey, nil
 	} else {
@@ -0,0 +1,248 @@
+package key
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+type RemoteKeySet struct {
+	URL       string
+	CacheDir  string
+	Client    *http.Client
+	mu        sync.Mutex
+	keys      *KeySet
+	refreshed bool
+}
+
+type cacheEntry struct {
+	URL     string          `json:"url"`
+	Expires time.Time       `json:"expires"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		log.Debug().Err(err).Msg("User cache directory not available, JWKS cache disabled")
+		return ""
+	}
+	return filepath.Join(dir, "jwe-tool", "jwks")
+}
+
+func NewRemoteKeySet(jwksURL string, cacheDir string, client *http.Client) (*RemoteKeySet, error) {
+	if err := checkURL(jwksURL); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &RemoteKeySet{
+		URL:      jwksURL,
+		CacheDir: cacheDir,
+		Client:   client,
+	}, nil
+}
+
+func DiscoverKeySet(issuer string, cacheDir string, client *http.Client) (*RemoteKeySet, error) {
+	configURL := strings.TrimSuffix(issuer, "/") + discoveryPath
+	if err := checkURL(configURL); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	log.Debug().Msgf("Discovering OpenID configuration from [%s] ...", configURL)
+	body, err := fetchCached(client, configURL, cacheDir, false)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("error parsing OpenID configuration %s: %w", configURL, err)
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("OpenID configuration issuer [%s] does not match [%s]", config.Issuer, issuer)
+	}
+	if config.JWKSURI == "" {
+		return nil, fmt.Errorf("OpenID configuration %s has no jwks_uri", configURL)
+	}
+	log.Info().Msgf("Discovered jwks_uri [%s]", config.JWKSURI)
+	return NewRemoteKeySet(config.JWKSURI, cacheDir, client)
+}
+
+func (r *RemoteKeySet) Keys() (*KeySet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys != nil {
+		return r.keys, nil
+	}
+	return r.load(false)
+}
+
+func (r *RemoteKeySet) Refresh() (*KeySet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load(true)
+}
+
+func (r *RemoteKeySet) refreshOnce(reason string) (*KeySet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refreshed {
+		return r.keys, nil
+	}
+	log.Info().Msgf("%s, refreshing %s ...", reason, r.URL)
+	return r.load(true)
+}
+
+func (r *RemoteKeySet) load(force bool) (*KeySet, error) {
+	body, err := fetchCached(r.Client, r.URL, r.CacheDir, force)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := LoadJSONWebKey(body, true)
+	if err != nil {
+		return nil, fmt.Errorf("error loading JsonWebKeySet from %s: %w", r.URL, err)
+	}
+	r.keys = keys
+	r.refreshed = r.refreshed || force
+	return keys, nil
+}
+
+func (r *RemoteKeySet) resolve(pub bool, kid string) (interface{}, interface{}, error) {
+	keys, err := r.Keys()
+	if err != nil {
+		return nil, nil, err
+	}
+	if kid != "" && len(keys.ByKeyID(kid)) == 0 {
+		if keys, err = r.refreshOnce(fmt.Sprintf("jsonWebKey [%s] not found", kid)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ResolveKeyPair(keys, pub, kid)
+}
+
+func checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("refusing to fetch keys over %s, https required: %s", u.Scheme, rawURL)
+	}
+	return nil
+}
+
+func fetchCached(client *http.Client, rawURL string, cacheDir string, force bool) ([]byte, error) {
+	cacheFile := ""
+	if cacheDir != "" {
+		sum := sha256.Sum256([]byte(rawURL))
+		cacheFile = filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".json")
+	}
+	if cacheFile != "" && !force {
+		if body, ok := readCache(cacheFile, rawURL); ok {
+			log.Debug().Msgf("Using cached response for [%s]", rawURL)
+			return body, nil
+		}
+	}
+
+	log.Debug().Msgf("Fetching [%s] ...", rawURL)
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", rawURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("response from %s is not valid json", rawURL)
+	}
+	if cacheFile != "" {
+		if expires, ok := cacheExpiry(resp.Header, time.Now()); ok {
+			writeCache(cacheFile, cacheEntry{URL: rawURL, Expires: expires, Body: body})
+		}
+	}
+	return body, nil
+}
+
+func cacheExpiry(header http.Header, now time.Time) (time.Time, bool) {
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(strings.ToLower(directive)), "=")
+			switch name {
+			case "no-store", "no-cache":
+				return time.Time{}, false
+			case "max-age":
+				seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+				if err != nil || seconds <= 0 {
+					return time.Time{}, false
+				}
+				return now.Add(time.Duration(seconds) * time.Second), true
+			}
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil && expires.After(now) {
+		return expires, true
+	}
+	return time.Time{}, false
+}
+
+func readCache(cacheFile string, rawURL string) ([]byte, bool) {
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Debug().Err(err).Msgf("Unable to read cache file %s", cacheFile)
+		}
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != rawURL {
+		return nil, false
+	}
+	if time.Now().After(entry.Expires) {
+		log.Debug().Msgf("Cached response for [%s] expired at %s", rawURL, entry.Expires)
+		return nil, false
+	}
+	return entry.Body, true
+}
+
+func writeCache(cacheFile string, entry cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(cacheFile), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(cacheFile, data, 0600)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Unable to write cache file %s", cacheFile)
+	}
+}
@@ -0,0 +1,201 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+type jwksServer struct {
+	*httptest.Server
+	mu           sync.Mutex
+	keys         []jose.JSONWebKey
+	cacheControl string
+	issuer       string
+	jwksHits     int32
+}
+
+func newJWKSServer(t *testing.T, kids ...string) *jwksServer {
+	t.Helper()
+	s := &jwksServer{}
+	s.setKeys(t, kids...)
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		issuer := s.issuer
+		if issuer == "" {
+			issuer = s.URL
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": s.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.jwksHits, 1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.cacheControl != "" {
+			w.Header().Set("Cache-Control", s.cacheControl)
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: s.keys})
+	})
+	s.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKeys(t *testing.T, kids ...string) {
+	t.Helper()
+	var keys []jose.JSONWebKey
+	for _, kid := range kids {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, jose.JSONWebKey{Key: &privateKey.PublicKey, KeyID: kid, Algorithm: "ES256", Use: "sig"})
+	}
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+func (s *jwksServer) hits() int {
+	return int(atomic.LoadInt32(&s.jwksHits))
+}
+
+func TestDiscoverKeySet(t *testing.T) {
+	server := newJWKSServer(t, "k1")
+	remote, err := DiscoverKeySet(server.URL, "", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.URL != server.URL+"/jwks" {
+		t.Fatalf("jwks_uri = %s", remote.URL)
+	}
+	keys, err := remote.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.Keys) != 1 || keys.Keys[0].KeyID != "k1" {
+		t.Fatalf("keys = %+v", keys.Keys)
+	}
+}
+
+func TestDiscoverKeySetIssuerMismatch(t *testing.T) {
+	server := newJWKSServer(t, "k1")
+	server.issuer = "https://issuer.example"
+	if _, err := DiscoverKeySet(server.URL, "", server.Client()); err == nil {
+		t.Fatal("expected issuer mismatch error")
+	}
+}
+
+func TestRemoteKeySetRequiresHTTPS(t *testing.T) {
+	if _, err := NewRemoteKeySet("http://issuer.example/jwks", "", nil); err == nil {
+		t.Fatal("expected error for http URL")
+	}
+}
+
+func TestRemoteKeySetCache(t *testing.T) {
+	for _, test := range []struct {
+		cacheControl string
+		hits         int
+	}{
+		{"max-age=300", 1},
+		{"no-store", 2},
+		{"", 2},
+	} {
+		t.Run(test.cacheControl, func(t *testing.T) {
+			server := newJWKSServer(t, "k1")
+			server.cacheControl = test.cacheControl
+			cacheDir := t.TempDir()
+			for i := 0; i < 2; i++ {
+				remote, err := NewRemoteKeySet(server.URL+"/jwks", cacheDir, server.Client())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := remote.Keys(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if server.hits() != test.hits {
+				t.Fatalf("server hits = %d, want %d", server.hits(), test.hits)
+			}
+		})
+	}
+}
+
+func TestRemoteKeySetRefreshOnUnknownKid(t *testing.T) {
+	server := newJWKSServer(t, "k1")
+	server.cacheControl = "max-age=300"
+	remote, err := NewRemoteKeySet(server.URL+"/jwks", t.TempDir(), server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SelectKeys(remote, true, "k1", KeyHint{}); err != nil {
+		t.Fatal(err)
+	}
+	server.setKeys(t, "k1", "k2")
+	candidates, err := SelectKeys(remote, true, "k2", KeyHint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].KeyID != "k2" {
+		t.Fatalf("candidates = %+v", candidates)
+	}
+	if server.hits() != 2 {
+		t.Fatalf("server hits = %d, want 2 (refresh bypasses the cache)", server.hits())
+	}
+	if _, err := SelectKeys(remote, true, "k3", KeyHint{}); err == nil {
+		t.Fatal("expected error for unknown kid")
+	}
+	if server.hits() != 2 {
+		t.Fatalf("server hits = %d, want a single refresh per run", server.hits())
+	}
+}
+
+func TestRemoteKeySetConcurrentSelect(t *testing.T) {
+	server := newJWKSServer(t, "k1")
+	remote, err := NewRemoteKeySet(server.URL+"/jwks", "", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectConcurrently := func(kid string) {
+		t.Helper()
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				candidates, err := SelectKeys(remote, true, kid, KeyHint{Use: "sig", Algorithm: "ES256"})
+				if err == nil && (len(candidates) != 1 || candidates[0].KeyID != kid) {
+					err = fmt.Errorf("candidates = %+v", candidates)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	selectConcurrently("k1")
+	if server.hits() != 1 {
+		t.Fatalf("server hits = %d, want a single load", server.hits())
+	}
+	server.setKeys(t, "k1", "k2")
+	selectConcurrently("k2")
+	if server.hits() != 2 {
+		t.Fatalf("server hits = %d, want a single refresh", server.hits())
+	}
+}
@@ -0,0 +1,111 @@
+package key
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+func LoadSecret(data []byte) ([]byte, error) {
+	log.Debug().Msg("Testing for symmetric JsonWebKey ...")
+	if jsonWebKey, err := LoadJSONWebKey(data, false); err == nil {
+		secret, _, err := ResolveKeyPair(jsonWebKey, false, "")
+		if err != nil {
+			return nil, err
+		}
+		if secret, ok := secret.([]byte); ok {
+			log.Debug().Msg("Found symmetric JsonWebKey")
+			return secret, nil
+		}
+		return nil, errors.New("JsonWebKey is not a symmetric key")
+	} else {
+		log.Trace().Err(err).Send()
+		if isJSONKey(data) {
+			return nil, fmt.Errorf("JSON key is not a symmetric oct JWK: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	log.Debug().Msg("Using raw secret")
+	return data, nil
+}
+
+func DecodeSecret(value string) ([]byte, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(value, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	secret, err := encoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid base64 secret")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	return secret, nil
+}
+
+func ReadSecret(source string) ([]byte, error) {
+	kind, value, found := strings.Cut(source, ":")
+	if !found {
+		return DecodeSecret(source)
+	}
+	switch kind {
+	case "base64":
+		return DecodeSecret(value)
+	case "hex":
+		secret, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.New("invalid hex secret")
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("empty secret")
+		}
+		return secret, nil
+	case "env":
+		env, ok := os.LookupEnv(value)
+		if !ok {
+			return nil, fmt.Errorf("environment variable [%s] not set", value)
+		}
+		return LoadSecret([]byte(env))
+	case "file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return LoadSecret(data)
+	case "fd":
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid secret file descriptor [%s]", value)
+		}
+		file := os.NewFile(uintptr(fd), "fd:"+value)
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		return LoadSecret(data)
+	}
+	return nil, fmt.Errorf("secret source [%s] not supported, use base64:|hex:|env:|file:|fd:", kind)
+}
+
+func isJSONKey(data []byte) bool {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return false
+	}
+	_, kty := members["kty"]
+	_, keys := members["keys"]
+	return kty || keys
+}
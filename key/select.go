@@ -0,0 +1,185 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.step.sm/crypto/keyutil"
+)
+
+type KeyHint struct {
+	KeyID       string
+	Thumbprints []string
+	Algorithm   string
+	Use         string
+}
+
+func (h KeyHint) empty() bool {
+	return h.KeyID == "" && len(h.Thumbprints) == 0
+}
+
+func (k JWKeyPair) Matches(hint KeyHint) bool {
+	if hint.KeyID != "" && hint.KeyID == k.KeyID {
+		return true
+	}
+	for _, thumbprint := range hint.Thumbprints {
+		if k.HasThumbprint(thumbprint) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k JWKeyPair) HasThumbprint(thumbprint string) bool {
+	if thumbprint == "" {
+		return false
+	}
+	for _, sum := range [][]byte{k.Thumbprint, k.ThumbprintS256} {
+		if len(sum) > 0 && base64.RawURLEncoding.EncodeToString(sum) == thumbprint {
+			return true
+		}
+	}
+	t, err := Thumbprint(k.PublicKey, crypto.SHA256)
+	return err == nil && t == thumbprint
+}
+
+func (k JWKeyPair) Usable(use string, alg string) bool {
+	if use != "" && k.Use != "" && k.Use != use {
+		return false
+	}
+	if alg == "" {
+		return true
+	}
+	if k.Algorithm != "" {
+		return k.Algorithm == alg
+	}
+	return Compatible(k.PublicKey, alg)
+}
+
+func SelectKeys(key interface{}, pub bool, kid string, hint KeyHint) ([]JWKeyPair, error) {
+	switch k := key.(type) {
+	case *RemoteKeySet:
+		keys, err := k.Keys()
+		if err != nil {
+			return nil, err
+		}
+		if kid != "" {
+			hint = KeyHint{KeyID: kid, Algorithm: hint.Algorithm, Use: hint.Use}
+		}
+		candidates, matched := selectFromSet(keys, kid, hint)
+		if !matched && !hint.empty() {
+			if keys, err = k.refreshOnce("No key matching " + describeHint(hint)); err != nil {
+				return nil, err
+			}
+			candidates, _ = selectFromSet(keys, kid, hint)
+		}
+		return checkCandidates(keys, candidates, kid, hint)
+	case *KeySet:
+		candidates, _ := selectFromSet(k, kid, hint)
+		return checkCandidates(k, candidates, kid, hint)
+	default:
+		privateKey, publicKey, err := ResolveKeyPair(key, pub, "")
+		if err != nil {
+			return nil, err
+		}
+		return []JWKeyPair{{PrivateKey: privateKey, PublicKey: publicKey, KeyID: kid}}, nil
+	}
+}
+
+func selectFromSet(keys *KeySet, kid string, hint KeyHint) ([]JWKeyPair, bool) {
+	usable := keys
+	if hint.Use != "" {
+		usable = &KeySet{Keys: usable.ByUse(hint.Use)}
+	}
+	if hint.Algorithm != "" {
+		usable = &KeySet{Keys: usable.ByAlgorithm(hint.Algorithm)}
+	}
+	if len(usable.Keys) < len(keys.Keys) {
+		log.Trace().Msgf("%d of %d jsonWebKeys usable for use [%s] and algorithm [%s]", len(usable.Keys), len(keys.Keys), hint.Use, hint.Algorithm)
+	}
+	if kid != "" {
+		candidates := usable.ByKeyID(kid)
+		return candidates, len(candidates) > 0
+	}
+	var matching []JWKeyPair
+	if hint.KeyID != "" {
+		matching = usable.ByKeyID(hint.KeyID)
+	}
+	for i, thumbprint := range hint.Thumbprints {
+		previous := KeyHint{KeyID: hint.KeyID, Thumbprints: hint.Thumbprints[:i]}
+		for _, pair := range usable.ByThumbprint(thumbprint) {
+			if !pair.Matches(previous) {
+				matching = append(matching, pair)
+			}
+		}
+	}
+	others := usable.filter(func(k JWKeyPair) bool {
+		return !k.Matches(hint)
+	})
+	return append(matching, others...), len(matching) > 0
+}
+
+func checkCandidates(keys *KeySet, candidates []JWKeyPair, kid string, hint KeyHint) ([]JWKeyPair, error) {
+	if len(candidates) == 0 {
+		if kid != "" && len(keys.ByKeyID(kid)) > 0 {
+			return nil, fmt.Errorf("jsonWebKey [%s] not usable for use [%s] and algorithm [%s]", kid, hint.Use, hint.Algorithm)
+		}
+		if kid != "" {
+			return nil, fmt.Errorf("jsonWebKey [%s] not found", kid)
+		}
+		if keys.Len() == 0 {
+			return nil, keys.emptyError()
+		}
+		if hint.Algorithm != "" || hint.Use != "" {
+			return nil, fmt.Errorf("no jsonWebKey usable for use [%s] and algorithm [%s]", hint.Use, hint.Algorithm)
+		}
+		return nil, errors.New("JsonWebKey empty")
+	}
+	return candidates, nil
+}
+
+func describeHint(hint KeyHint) string {
+	var parts []string
+	if hint.KeyID != "" {
+		parts = append(parts, "kid "+hint.KeyID)
+	}
+	for _, thumbprint := range hint.Thumbprints {
+		parts = append(parts, "thumbprint "+thumbprint)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func Compatible(key interface{}, alg string) bool {
+	if publicKey, err := keyutil.PublicKey(key); err == nil {
+		key = publicKey
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS") || strings.HasPrefix(alg, "RSA")
+	case *ecdsa.PublicKey:
+		switch alg {
+		case "ES256":
+			return k.Curve.Params().Name == "P-256"
+		case "ES384":
+			return k.Curve.Params().Name == "P-384"
+		case "ES512":
+			return k.Curve.Params().Name == "P-521"
+		}
+		return strings.HasPrefix(alg, "ECDH-ES")
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	case *ecdh.PublicKey, *ecdh.PrivateKey:
+		return strings.HasPrefix(alg, "ECDH-ES")
+	case []byte:
+		return strings.HasPrefix(alg, "HS") || strings.HasPrefix(alg, "A") || alg == "dir" || strings.HasPrefix(alg, "PBES2")
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"encoding/base64"
+	"fmt"
+
+	jose "github.com/go-jose/go-jose/v3"
+)
+
+const (
+	octThumbprintTemplate    = `{"k":"%s","kty":"oct"}`
+	x25519ThumbprintTemplate = `{"crv":"X25519","kty":"OKP","x":"%s"}`
+)
+
+func Thumbprint(key interface{}, hash crypto.Hash) (string, error) {
+	var input string
+	switch k := key.(type) {
+	case []byte:
+		input = fmt.Sprintf(octThumbprintTemplate, base64.RawURLEncoding.EncodeToString(k))
+	case *ecdh.PrivateKey:
+		input = fmt.Sprintf(x25519ThumbprintTemplate, base64.RawURLEncoding.EncodeToString(k.PublicKey().Bytes()))
+	case *ecdh.PublicKey:
+		input = fmt.Sprintf(x25519ThumbprintTemplate, base64.RawURLEncoding.EncodeToString(k.Bytes()))
+	default:
+		jwk := jose.JSONWebKey{Key: key}
+		sum, err := jwk.Thumbprint(hash)
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(sum), nil
+	}
+	h := hash.New()
+	h.Write([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
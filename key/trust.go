@@ -0,0 +1,116 @@
+package key
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const SystemTrust = "system"
+
+type TrustOptions struct {
+	Roots    *x509.CertPool
+	AllowX5C bool
+}
+
+func LoadTrustRoots(sources []string) (*x509.CertPool, error) {
+	roots := x509.NewCertPool()
+	for _, source := range sources {
+		if source == SystemTrust {
+			system, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("loading system certificate pool: %w", err)
+			}
+			log.Debug().Msg("Using system certificate pool")
+			roots = system
+			break
+		}
+	}
+	for _, source := range sources {
+		if source == SystemTrust {
+			continue
+		}
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		certificates := parseCertificates(data)
+		if len(certificates) == 0 {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", source)
+		}
+		for _, certificate := range certificates {
+			roots.AddCert(certificate)
+		}
+		log.Debug().Msgf("Loaded %d CA certificates from %s", len(certificates), source)
+	}
+	return roots, nil
+}
+
+func ParseCertificateChain(x5c []interface{}) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for i, value := range x5c {
+		encoded, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("x5c entry %d is not a string", i)
+		}
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("x5c entry %d: %w", i, err)
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("x5c entry %d: %w", i, err)
+		}
+		chain = append(chain, certificate)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("x5c is empty")
+	}
+	return chain, nil
+}
+
+func CertificateKeyPair(chain []*x509.Certificate) JWKeyPair {
+	pair := JWKeyPair{PublicKey: chain[0].PublicKey}
+	pair.setCertificates(chain)
+	return pair
+}
+
+func (k *JWKeyPair) setCertificates(chain []*x509.Certificate) {
+	k.Certificates = chain
+	sha1Sum := sha1.Sum(chain[0].Raw)
+	sha256Sum := sha256.Sum256(chain[0].Raw)
+	k.Thumbprint = sha1Sum[:]
+	k.ThumbprintS256 = sha256Sum[:]
+}
+
+func (t *TrustOptions) VerifyChain(chain []*x509.Certificate, at time.Time) error {
+	if len(chain) == 0 {
+		return errors.New("no certificate")
+	}
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, certificate := range chain[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         t.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate [%s] not trusted at %s: %w", leaf.Subject, at.UTC().Format(time.RFC3339), err)
+	}
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("certificate [%s] key usage does not allow digital signatures", leaf.Subject)
+	}
+	log.Debug().Msgf("Certificate [%s] trusted", leaf.Subject)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	stdcrypto "crypto"
+	"flag"
+
+	"github.com/fatih/color"
+	jose "github.com/go-jose/go-jose/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/typhoon51280/jwe-tool/ioutil"
+	"github.com/typhoon51280/jwe-tool/key"
+)
+
+var keyType = flag.String("kty", "RSA", "keygen key type: RSA|EC|OKP|oct")
+var keyCurve = flag.String("crv", "", "keygen curve: P-256|P-384|P-521 (EC), Ed25519|X25519 (OKP)")
+var keySize = flag.Int("size", 0, "keygen key size in bits: RSA (default 2048), oct (default 256)")
+var kidThumbprint = flag.Bool("kid-thumbprint", false, "keygen and convert: use the RFC 7638 thumbprint as Key ID")
+var keyUse = flag.String("use", "", "keygen and convert key use: sig|enc")
+var keyAlgorithm = flag.String("key-alg", "", "keygen and convert key algorithm (alg)")
+var keyFormat = flag.String("format", key.FormatPKCS8, "keygen and convert key format: pkcs1|pkcs8|sec1|pkix|openssh|jwk|jwks")
+var outPubFile = flag.String("out-pub", "", "public key output file path")
+var outPass = flag.String("out-pass", "", "keygen: encrypt the private key (pkcs8) with the password from source env:<VAR>|file:<path>|fd:<N>|stdin|askpass[:<command>]|prompt")
+
+func keygen() {
+
+	var privateKey interface{}
+	var err error
+	if len(*inFile) > 0 {
+		log.Info().Msg("Start exporting key ...")
+		privateKey, _, err = key.LoadKeyPair(ioutil.LoadInput(*inFile), createLoadOptions("input", ""))
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error loading key %v", *inFile)
+		}
+		if keySet, ok := privateKey.(*key.KeySet); ok {
+			if keySet.Len() != 1 {
+				log.Fatal().Msgf("Key %v contains several keys, export them one at a time", *inFile)
+			}
+			privateKey = keySet.Keys[0].PrivateKey
+		}
+	} else {
+		log.Info().Msg("Start generating key ...")
+		privateKey, err = key.GenerateKey(key.GenerateOptions{
+			KeyType: *keyType,
+			Curve:   *keyCurve,
+			Size:    *keySize,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error generating key")
+		}
+		log.Debug().Msgf("Key %s generated", *keyType)
+	}
+
+	thumbprint, err := key.Thumbprint(privateKey, stdcrypto.SHA256)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error computing key thumbprint")
+	}
+	keyID := *kid
+	if *kidThumbprint {
+		keyID = thumbprint
+	}
+	jwk := jose.JSONWebKey{
+		Key:       privateKey,
+		KeyID:     keyID,
+		Use:       *keyUse,
+		Algorithm: *keyAlgorithm,
+	}
+
+	var privateData []byte
+	if len(*outPass) > 0 {
+		if *keyFormat != key.FormatPKCS8 {
+			log.Fatal().Msgf("Password protection requires -format %s", key.FormatPKCS8)
+		}
+		password, err := key.PasswordSource(*outPass)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid -out-pass password source")
+		}
+		passwordBytes, err := password("New password (ENCRYPTED PRIVATE KEY): ")
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error reading private key password")
+		}
+		if privateData, err = key.MarshalEncryptedKey(privateKey, passwordBytes); err != nil {
+			log.Fatal().Err(err).Msg("Error encrypting private key")
+		}
+	} else if privateData, err = key.MarshalKey(jwk, *keyFormat); err != nil {
+		log.Fatal().Err(err).Msgf("Error encoding private key as %s", *keyFormat)
+	}
+	log.Info().Msgf("Private Key [%s] %T, thumbprint (RFC 7638 SHA-256): %s", keyID, privateKey, thumbprint)
+	writeOutput(string(privateData), true)
+
+	if _, symmetric := privateKey.([]byte); !symmetric {
+		publicKey, err := key.PublicKeyOf(privateKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Error extracting public key")
+		}
+		jwk.Key = publicKey
+		publicFormat := key.PublicFormat(*keyFormat)
+		publicData, err := key.MarshalKey(jwk, publicFormat)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error encoding public key as %s", publicFormat)
+		}
+		if len(*outPubFile) > 0 {
+			ioutil.WriteOutput(*outPubFile, string(publicData))
+		}
+		log.Info().Msgf("Public Key |-\n%s", ioutil.PrintText("Public Key", string(publicData), color.BgCyan, color.FgWhite, color.Bold))
+	}
+
+	log.Info().Msg("DONE 😀")
+
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/rs/zerolog/log"
@@ -11,17 +15,61 @@ import (
 	"github.com/typhoon51280/jwe-tool/key"
 )
 
-var flgOp = flag.String("command", "decrypt", "encrypt|decrypt|verify|sign")
+const (
+	exitInvalidSignature = 2
+	exitInvalidClaims    = 3
+	exitInvalidPayload   = 4
+)
+
+var flgOp = flag.String("command", "decrypt", "encrypt|decrypt|verify|sign|inspect|keygen|convert|inspect-key")
 var token = flag.String("token", "", "token")
-var encKeyPath = flag.String("enc", "", "encrypt key path")
-var sigKeyPath = flag.String("sig", "", "sign key path")
+var encKeyPaths = newStringList("enc", "encrypt key path (- for stdin, fd:<N>), repeat for multiple recipients")
+var encSecret = flag.String("enc-secret", "", "encrypt shared secret: <base64>|base64:<value>|hex:<value>|env:<VAR>|file:<path>|fd:<N>")
+var encPassphrase = flag.String("enc-passphrase", "", "encrypt passphrase (PBES2 algorithms)")
+var sigKeyPath = flag.String("sig", "", "sign key path, - for stdin, fd:<N> for a file descriptor")
+var sigSecret = flag.String("sig-secret", "", "sign shared secret (HMAC): <base64>|base64:<value>|hex:<value>|env:<VAR>|file:<path>|fd:<N>")
+var oidcIssuer = flag.String("issuer", "", "OpenID issuer URL, sign keys are fetched from its jwks_uri")
+var jwksCache = flag.String("jwks-cache", key.DefaultCacheDir(), "cache directory for remote JWKS, empty to disable")
+var keyPass = flag.String("pass", "", "private key password source: env:<VAR>|file:<path>|fd:<N>|stdin|askpass[:<command>]|prompt")
+var encKeyPass = flag.String("enc-key-pass", "", "encrypt private key password source (default -pass)")
+var sigKeyPass = flag.String("sig-key-pass", "", "sign private key password source (default -pass)")
+var sigKeyHeaders = newStringList("sig-key-header", "add a signing key header to the JWS, repeatable: x5c|x5t|x5t#S256|jwk|jku=<url>|x5u=<url>")
+var encKeyHeaders = newStringList("enc-key-header", "add an encryption key header to the JWE, repeatable: x5c|x5t|x5t#S256|jwk|jku=<url>|x5u=<url>")
+var sigHeaders = newStringList("header", "add a JWS protected header, repeatable: name=<string>|name:=<json>")
+var sigHeaderFile = flag.String("header-file", "", "JSON object of JWS protected headers, -header values override it")
+var encHeaders = newStringList("enc-header", "add a JWE protected header, repeatable: name=<string>|name:=<json>")
+var encHeaderFile = flag.String("enc-header-file", "", "JSON object of JWE protected headers, -enc-header values override it")
+var criticalNames = newStringList("crit", "critical (crit) header name understood when verifying or decrypting, repeatable")
+var trustRoots = newStringList("ca", "trusted CA bundle path or \"system\", repeatable: validates certificate chains of verification keys")
+var allowX5C = flag.Bool("x5c", false, "accept verification keys from the token x5c header, validated against -ca")
+var keyAlias = flag.String("alias", "", "PKCS12 entry alias (friendly name)")
 var kid = flag.String("kid", "", "Key ID")
-var inFile = flag.String("in", "", "output file path")
-var outFile = flag.String("out", "", "output file path")
+var inFile = flag.String("in", "", "input file path, - for stdin, fd:<N> for a file descriptor")
+var outFile = flag.String("out", "", "output file path, - for stdout (default stdout when not a terminal)")
 var encryptCypher = flag.String("cypher", "A128GCM", "encrypt cypher")
-var encryptAlgorithm = flag.String("alg-encode", "RSA-OAEP", "encrypt algorithm")
+var encryptAlgorithms = newStringList("alg-encode", "encrypt algorithm, repeat to set it per recipient (default RSA-OAEP)", "RSA-OAEP")
+var nesting = flag.String("nesting", crypto.NestingSignEncrypt, "encrypt nesting order: sign-encrypt|encrypt-sign|encrypt (no signing)")
+var serialization = flag.String("serialization", "", "JWE serialization: compact|json|flattened (default compact, json for multiple recipients)")
 var signAlgorithm = flag.String("alg-sign", "RS256", "encrypt algorithm")
 var duration = flag.String("duration", "1h", "token duration")
+var notBefore = flag.String("nbf", "0s", "not before offset from iat, e.g. -30s or 5m")
+var noExpiry = flag.Bool("no-exp", false, "issue a token without exp claim")
+var issuedAt = flag.String("iat", "", "pin iat to this time (RFC 3339 or epoch seconds)")
+var preserveClaims = flag.Bool("preserve-claims", false, "keep iat, nbf and exp already present in the payload")
+var generateID = flag.Bool("jti", false, "generate a random jti claim if missing")
+var claimValues = newStringList("claim", "sign and encrypt: add a claim over the -in template, repeatable: name=<string>|name:=<json>")
+var templateMode = flag.Bool("template", false, "render -in as a claims template before signing (implied by -var and -var-file)")
+var templateVars = newStringList("var", "claims template variable, repeatable: name=<string>|name:=<json>")
+var templateVarFile = flag.String("var-file", "", "JSON object of claims template variables, -var values override it")
+
+// Claims validation
+var issuer = flag.String("iss", "", "expected issuer (iss), issuer claim when signing")
+var audiences = newStringList("aud", "expected audience (aud), repeat to accept any of several, audience claim when signing")
+var subject = flag.String("sub", "", "expected subject (sub), subject claim when signing")
+var requiredClaims = newStringList("require", "required claim name, repeatable")
+var maxAge = flag.String("max-age", "", "maximum token age computed from iat, e.g. 15m")
+var leeway = flag.String("leeway", "0s", "clock skew leeway for exp, nbf and iat")
+var validationTime = flag.String("now", "", "validate as of this time (RFC 3339 or epoch seconds)")
 
 // Logging
 var logLevel = flag.String("log", "info", "log level: panic|fatal|error|warn|info|debug|trace\\all")
@@ -37,6 +85,13 @@ func main() {
 		File:  logFile,
 		Level: *logLevel,
 	})
+	if stdinPassword() && (*inFile == ioutil.Stdio || *batchSource == ioutil.Stdio || stdinKey()) {
+		log.Fatal().Msg("Password source stdin cannot be combined with -in -, -batch - or a key read from stdin")
+	}
+	if len(*batchSource) > 0 {
+		batch()
+		return
+	}
 	switch *flgOp {
 	case "encrypt":
 		encrypt()
@@ -46,17 +101,29 @@ func main() {
 		verify()
 	case "sign":
 		sign()
+	case "inspect":
+		inspect()
+	case "keygen":
+		keygen()
+	case "convert":
+		convert()
+	case "inspect-key":
+		inspectKey()
 	default:
-		fmt.Println("pass either encrypt|decrypt|verify|sign")
+		fmt.Println("pass either encrypt|decrypt|verify|sign|inspect|keygen|convert|inspect-key")
 	}
 }
 
-func createEncOptions(privateKey interface{}, publicKey interface{}) crypto.EncodeOptions {
+func createEncOptions(recipients []crypto.Recipient) crypto.EncodeOptions {
 	encOptions := crypto.EncodeOptions{
-		Algorithm:  *encryptAlgorithm,
-		Encoding:   *encryptCypher,
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
+		Algorithm:     encryptAlgorithms.At(0),
+		Encoding:      *encryptCypher,
+		Recipients:    recipients,
+		Serialization: *serialization,
+		Nesting:       *nesting,
+		KeyHeaders:    createKeyHeaders("enc-key-header", encKeyHeaders),
+		Headers:       createHeaders("enc-header", *encHeaderFile, encHeaders),
+		Critical:      criticalNames.Values(),
 	}
 	return encOptions
 }
@@ -68,50 +135,398 @@ func createSignOptions(privateKey interface{}, publicKey interface{}) crypto.Sig
 		PublicKey:  publicKey,
 		Kid:        *kid,
 		Duration:   *duration,
+		TimeClaims: crypto.TimeClaimsOptions{
+			Preserve:   *preserveClaims,
+			IssuedAt:   *issuedAt,
+			NotBefore:  *notBefore,
+			NoExpiry:   *noExpiry,
+			GenerateID: *generateID,
+		},
+		Validation: createValidationOptions(),
+		Trust:      createTrustOptions(),
+		KeyHeaders: createKeyHeaders("sig-key-header", sigKeyHeaders),
+		Headers:    createHeaders("header", *sigHeaderFile, sigHeaders),
+		Critical:   criticalNames.Values(),
 	}
 	return signOptions
 }
 
-func decrypt() {
+func createKeyHeaders(name string, values *stringList) crypto.KeyHeaders {
+	keyHeaders, err := crypto.ParseKeyHeaders(values.Values())
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Invalid parameter -%s", name)
+	}
+	return keyHeaders
+}
 
-	if len(*encKeyPath) == 0 {
-		log.Fatal().Msg("Missing parameter: -encKey")
+func loadTokenInput() string {
+	switch {
+	case len(*token) > 0:
+		return *token
+	case len(*inFile) > 0:
+		return strings.TrimSpace(ioutil.LoadInputStr(*inFile))
+	case ioutil.StdinPiped() && !stdinKey() && !stdinPassword():
+		log.Debug().Msg("Reading token from stdin")
+		return strings.TrimSpace(ioutil.LoadInputStr(ioutil.Stdio))
 	}
-	if len(*inFile) == 0 && len(*token) == 0 {
-		log.Fatal().Msg("Pass either -in or -token")
+	log.Fatal().Msg("Pass either -in or -token, or pipe the token to stdin")
+	return ""
+}
+
+func stdinKey() bool {
+	for _, path := range append([]string{*sigKeyPath}, encKeyPaths.Values()...) {
+		if path == ioutil.Stdio {
+			return true
+		}
 	}
+	return false
+}
 
-	log.Info().Msg("Start decrypting ...")
+func stdinPassword() bool {
+	for _, source := range []string{*keyPass, *encKeyPass, *sigKeyPass, *outPass} {
+		if source == "stdin" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeResult(text string) {
+	writeOutput(text, false)
+}
 
-	input := *token
+func outputPath() string {
+	if len(*outFile) > 0 {
+		return *outFile
+	}
+	if ioutil.IsTerminal(os.Stdout) {
+		return ""
+	}
+	return ioutil.Stdio
+}
+
+func writePlaintext(plaintext string) {
+	if filename := outputPath(); len(filename) > 0 {
+		ioutil.WriteData(filename, []byte(plaintext))
+	}
+}
+
+func writeOutput(text string, secret bool) {
+	filename := outputPath()
+	if len(filename) == 0 && secret {
+		filename = ioutil.Stdio
+	}
+	if len(filename) == 0 {
+		return
+	}
+	if secret {
+		ioutil.WriteSecretOutput(filename, text)
+	} else {
+		ioutil.WriteOutput(filename, text)
+	}
+}
+
+func hasClaimFlags() bool {
+	return len(claimValues.Values()) > 0 || len(*issuer) > 0 || len(*subject) > 0 || len(audiences.Values()) > 0
+}
+
+func isTemplate() bool {
+	return *templateMode || len(templateVars.Values()) > 0 || len(*templateVarFile) > 0
+}
+
+func loadClaims() string {
+	var template []byte
 	if len(*inFile) > 0 {
-		input = ioutil.LoadInputStr(*inFile)
+		template = ioutil.LoadInput(*inFile)
+	}
+	if isTemplate() {
+		if len(*inFile) == 0 {
+			log.Fatal().Msg("Claims template requires -in")
+		}
+		rendered, err := crypto.RenderTemplate(*inFile, template, createTemplateOptions())
+		if err != nil {
+			log.Error().Err(err).Msgf("Invalid claims template %s", *inFile)
+			os.Exit(exitInvalidPayload)
+		}
+		log.Debug().Msgf("Rendered claims template: %s", rendered)
+		template = rendered
+	}
+	payload, err := crypto.BuildClaims(template, createClaimsOptions())
+	if err != nil {
+		log.Error().Err(err).Msgf("Invalid claims template %s", *inFile)
+		os.Exit(exitInvalidPayload)
+	}
+	log.Debug().Msgf("Claims: %s", payload)
+	return payload
+}
+
+func createClaimsOptions() crypto.ClaimsOptions {
+	claims := map[string]interface{}{}
+	if err := parseAssignments(claimValues.Values(), claims); err != nil {
+		log.Error().Err(err).Msg("Invalid parameter -claim")
+		os.Exit(exitInvalidPayload)
+	}
+	return crypto.ClaimsOptions{
+		Issuer:   *issuer,
+		Subject:  *subject,
+		Audience: audiences.Values(),
+		Claims:   claims,
+	}
+}
+
+func createTemplateOptions() crypto.TemplateOptions {
+	variables := map[string]interface{}{}
+	if len(*templateVarFile) > 0 {
+		decoded, err := decodeJSON(ioutil.LoadInput(*templateVarFile))
+		if err != nil {
+			log.Error().Err(err).Msgf("Invalid parameter -var-file %s", *templateVarFile)
+			os.Exit(exitInvalidPayload)
+		}
+		object, ok := decoded.(map[string]interface{})
+		if !ok {
+			log.Error().Msgf("Invalid parameter -var-file %s, expecting a JSON object", *templateVarFile)
+			os.Exit(exitInvalidPayload)
+		}
+		variables = object
+	}
+	if err := parseAssignments(templateVars.Values(), variables); err != nil {
+		log.Error().Err(err).Msg("Invalid parameter -var")
+		os.Exit(exitInvalidPayload)
+	}
+	var now time.Time
+	if len(*issuedAt) > 0 {
+		var err error
+		if now, err = crypto.ParseTime(*issuedAt); err != nil {
+			log.Fatal().Err(err).Msg("Invalid parameter -iat")
+		}
+	}
+	return crypto.TemplateOptions{Variables: variables, Now: now}
+}
+
+func createHeaders(name string, headerFile string, values *stringList) map[string]interface{} {
+	if len(headerFile) == 0 && len(values.Values()) == 0 {
+		return nil
 	}
+	headers := map[string]interface{}{}
+	if len(headerFile) > 0 {
+		decoded, err := decodeJSON(ioutil.LoadInput(headerFile))
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Invalid parameter -%s-file %s", name, headerFile)
+		}
+		object, ok := decoded.(map[string]interface{})
+		if !ok {
+			log.Fatal().Msgf("Invalid parameter -%s-file %s, expecting a JSON object", name, headerFile)
+		}
+		headers = object
+	}
+	if err := parseAssignments(values.Values(), headers); err != nil {
+		log.Fatal().Err(err).Msgf("Invalid parameter -%s", name)
+	}
+	return headers
+}
 
-	encKeyBytes := ioutil.LoadInput(*encKeyPath)
-	encPrivateKey, encPublicKey, err := key.LoadKeyPair(encKeyBytes, true)
+func createTrustOptions() *key.TrustOptions {
+	if len(trustRoots.Values()) == 0 {
+		if *allowX5C {
+			log.Fatal().Msg("Parameter -x5c requires -ca")
+		}
+		return nil
+	}
+	roots, err := key.LoadTrustRoots(trustRoots.Values())
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Error loading encrypt private key %v", *encKeyPath)
+		log.Fatal().Err(err).Msg("Error loading -ca trust anchors")
 	}
-	log.Debug().Msgf("Decrypt Private Key Loaded")
+	return &key.TrustOptions{Roots: roots, AllowX5C: *allowX5C}
+}
 
-	encOptions := createEncOptions(encPrivateKey, encPublicKey)
-	signOptions := crypto.SignOptions{};
-	if len(*sigKeyPath) > 0 {
-		sigKeyBytes := ioutil.LoadInput(*sigKeyPath)
-		sigPublicKey, err := key.LoadPublicKey(sigKeyBytes, true)
+func createValidationOptions() crypto.ValidationOptions {
+	validationOptions := crypto.ValidationOptions{
+		Issuer:         *issuer,
+		Audience:       audiences.Values(),
+		Subject:        *subject,
+		RequiredClaims: requiredClaims.Values(),
+	}
+	if validationOptions.Issuer == "" {
+		validationOptions.Issuer = *oidcIssuer
+	}
+	var err error
+	if validationOptions.Leeway, err = time.ParseDuration(*leeway); err != nil {
+		log.Fatal().Err(err).Msgf("Invalid parameter -leeway %s", *leeway)
+	}
+	if len(*maxAge) > 0 {
+		if validationOptions.MaxAge, err = time.ParseDuration(*maxAge); err != nil {
+			log.Fatal().Err(err).Msgf("Invalid parameter -max-age %s", *maxAge)
+		}
+	}
+	if len(*validationTime) > 0 {
+		if validationOptions.Now, err = crypto.ParseTime(*validationTime); err != nil {
+			log.Fatal().Err(err).Msg("Invalid parameter -now")
+		}
+	}
+	return validationOptions
+}
+
+func createLoadOptions(name string, passwordSource string) key.LoadOptions {
+	if len(passwordSource) == 0 {
+		passwordSource = *keyPass
+	}
+	password, err := key.PasswordSource(passwordSource)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Invalid %s key password source", name)
+	}
+	return key.LoadOptions{CheckForPassword: true, Password: password, Alias: *keyAlias}
+}
+
+func loadKey(name string, keyPath string, secretSource string, private bool, loadOptions key.LoadOptions) (interface{}, interface{}) {
+	if len(secretSource) > 0 {
+		secret, err := key.ReadSecret(secretSource)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error loading %s secret", name)
+		}
+		return secret, secret
+	}
+	if key.IsRemote(keyPath) {
+		if private {
+			log.Fatal().Msgf("Remote %s key %v only provides public keys", name, keyPath)
+		}
+		remote, err := key.NewRemoteKeySet(keyPath, *jwksCache, nil)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error loading %s key %v", name, keyPath)
+		}
+		return nil, remote
+	}
+
+	keyBytes := ioutil.LoadInput(keyPath)
+	var privateKey, publicKey interface{}
+	var err error
+	if private {
+		privateKey, publicKey, err = key.LoadKeyPair(keyBytes, loadOptions)
+	} else {
+		publicKey, err = key.LoadPublicKey(keyBytes, loadOptions)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Error loading %s key %v (shared secrets need an oct JWK, -sig-secret or -enc-secret)", name, keyPath)
+	}
+	return privateKey, publicKey
+}
+
+func hasEncryptKey() bool {
+	return len(encKeyPaths.Values()) > 0 || len(*encSecret) > 0 || len(*encPassphrase) > 0
+}
+
+func loadEncryptKeys(private bool) []crypto.Recipient {
+	var recipients []crypto.Recipient
+	addRecipient := func(privateKey interface{}, publicKey interface{}) {
+		recipient := crypto.Recipient{
+			Algorithm: encryptAlgorithms.At(len(recipients)),
+			Key:       publicKey,
+		}
+		if private {
+			recipient.Key = privateKey
+		}
+		recipients = append(recipients, recipient)
+	}
+	loadOptions := createLoadOptions("encrypt", *encKeyPass)
+	for _, path := range encKeyPaths.Values() {
+		privateKey, publicKey := loadKey("encrypt", path, "", private, loadOptions)
+		if remote, ok := publicKey.(*key.RemoteKeySet); ok {
+			keys, err := remote.Keys()
+			if err != nil {
+				log.Fatal().Err(err).Msgf("Error loading encrypt key %v", path)
+			}
+			publicKey = keys
+		}
+		addRecipient(privateKey, publicKey)
+	}
+	if len(*encSecret) > 0 {
+		addRecipient(loadKey("encrypt", "", *encSecret, private, loadOptions))
+	}
+	if len(*encPassphrase) > 0 {
+		addRecipient([]byte(*encPassphrase), []byte(*encPassphrase))
+	}
+	return recipients
+}
+
+func hasSignKey(private bool) bool {
+	return len(*sigKeyPath) > 0 || len(*sigSecret) > 0 || (!private && (len(*oidcIssuer) > 0 || *allowX5C))
+}
+
+func loadSignKey(private bool) (interface{}, interface{}) {
+	if !private && len(*sigKeyPath) == 0 && len(*sigSecret) == 0 && len(*oidcIssuer) == 0 {
+		log.Info().Msg("No sign key, using the token x5c header")
+		return nil, nil
+	}
+	if !private && len(*sigKeyPath) == 0 && len(*sigSecret) == 0 {
+		remote, err := key.DiscoverKeySet(*oidcIssuer, *jwksCache, nil)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Error discovering sign keys of issuer %v", *oidcIssuer)
+		}
+		return nil, remote
+	}
+	return loadKey("sign", *sigKeyPath, *sigSecret, private, createLoadOptions("sign", *sigKeyPass))
+}
+
+func checkVerifyResult(result *crypto.VerifyResult, err error, checkSignature bool) {
+	if result == nil || errors.Is(err, crypto.ErrKeyNotFound) {
+		if checkSignature && errors.Is(err, crypto.ErrSignatureInvalid) {
+			log.Error().Err(err).Msg("Token signature not valid")
+			os.Exit(exitInvalidSignature)
+		}
 		if err != nil {
-			log.Fatal().Err(err).Msgf("Error loading sign public key %v", *sigKeyPath)
+			log.Fatal().Err(err).Msg("Error verifying token")
 		}
+		return
+	}
+	log.Info().Msgf("Verification Result |-\n%s", ioutil.PrintText("Verification", ioutil.PrettyJSON(result), color.BgCyan, color.FgWhite, color.Bold))
+	if checkSignature && !result.SignatureValid {
+		log.Error().Err(err).Msg("Token signature not valid")
+		os.Exit(exitInvalidSignature)
+	}
+	if !result.ClaimsValid {
+		log.Error().Err(err).Msg("Token claims not valid")
+		os.Exit(exitInvalidClaims)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error verifying token")
+	}
+}
+
+func decrypt() {
+
+	if !hasEncryptKey() {
+		log.Fatal().Msg("Missing parameter: -enc, -enc-secret or -enc-passphrase")
+	}
+	log.Info().Msg("Start decrypting ...")
+
+	input := loadTokenInput()
+
+	encOptions := createEncOptions(loadEncryptKeys(true))
+	log.Debug().Msgf("Decrypt Private Key Loaded")
+
+	signOptions := crypto.SignOptions{Validation: createValidationOptions(), Critical: criticalNames.Values()}
+	if hasSignKey(false) {
+		_, sigPublicKey := loadSignKey(false)
 		signOptions = createSignOptions(nil, sigPublicKey)
 	}
 
-	plaintext, token := crypto.Decode(input, encOptions, signOptions)
-	log.Info().Msgf("JWT Serialized |-\n%s", ioutil.PrintText("JWT", plaintext, color.BgCyan, color.FgWhite, color.Bold))
-	log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(token, signOptions.PublicKey))
+	result, err := crypto.Decode(input, encOptions, signOptions)
+	if result == nil {
+		log.Fatal().Err(err).Msg("Error decrypting token")
+	}
+	log.Info().Msgf("Token Layers |-\n%s", ioutil.PrintText("Layers", ioutil.PrettyJSON(result.Layers), color.BgCyan, color.FgWhite, color.Bold))
+	if errors.Is(err, crypto.ErrDecrypt) {
+		log.Fatal().Err(err).Msg("Error decrypting token")
+	}
 
-	if len(*outFile) > 0 {
-		ioutil.WriteOutput(*outFile, ioutil.PrettyJSON(token.Claims))
+	if result.Verification == nil {
+		checkVerifyResult(nil, err, hasSignKey(false))
+		log.Info().Msgf("Plaintext |-\n%s", ioutil.PrintText("Plaintext", result.Plaintext, color.BgCyan, color.FgWhite, color.Bold))
+		writePlaintext(result.Plaintext)
+	} else {
+		log.Info().Msgf("JWT Serialized |-\n%s", ioutil.PrintText("JWT", result.Plaintext, color.BgCyan, color.FgWhite, color.Bold))
+		log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(*result.Verification.Token, signOptions.PublicKey))
+		checkVerifyResult(result.Verification, err, hasSignKey(false))
+		writeResult(ioutil.PrettyJSON(result.Verification.Token.Claims))
 	}
 
 	log.Info().Msg("DONE 😀")
@@ -119,39 +534,44 @@ func decrypt() {
 
 func encrypt() {
 
-	if len(*encKeyPath) == 0 {
-		log.Fatal().Msg("Missing parameter: -encKey")
+	if !hasEncryptKey() {
+		log.Fatal().Msg("Missing parameter: -enc, -enc-secret or -enc-passphrase")
 	}
-	if len(*inFile) == 0 {
-		log.Fatal().Msg("Missing parameter: -in")
+	if len(*inFile) == 0 && !hasClaimFlags() {
+		log.Fatal().Msg("Missing parameter: -in or -claim")
 	}
 
 	log.Info().Msg("Start encrypting ...")
 
-	input := ioutil.LoadInputStr(*inFile)
-
-	encKeyBytes := ioutil.LoadInput(*encKeyPath)
-	encPublicKey, err := key.LoadPublicKey(encKeyBytes, true)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("Error loading encrypt public key %v", *encKeyPath)
+	var input string
+	if hasClaimFlags() || *nesting == crypto.NestingSignEncrypt {
+		input = loadClaims()
+	} else {
+		input = ioutil.LoadInputStr(*inFile)
 	}
+
+	encOptions := createEncOptions(loadEncryptKeys(false))
 	log.Debug().Msgf("Encrypt Public Key Loaded")
 
-	encOptions := createEncOptions(nil, encPublicKey)
-	sigKeyBytes := ioutil.LoadInput(*sigKeyPath)
-	sigPrivateKey, sigPublicKey, err := key.LoadKeyPair(sigKeyBytes, true)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("Error loading sign private key %v", *sigKeyPath)
+	signOptions := crypto.SignOptions{}
+	if *nesting != crypto.NestingEncrypt {
+		if !hasSignKey(true) {
+			log.Fatal().Msg("Missing parameter: -sig or -sig-secret")
+		}
+		sigPrivateKey, sigPublicKey := loadSignKey(true)
+		signOptions = createSignOptions(sigPrivateKey, sigPublicKey)
 	}
-	signOptions := createSignOptions(sigPrivateKey, sigPublicKey)
 
-	tokenEncrypted, token := crypto.Encode(input, encOptions, signOptions)
-	log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(token, signOptions.PublicKey))
+	tokenEncrypted, token, err := crypto.Encode(input, encOptions, signOptions)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error encrypting token")
+	}
+	if token != nil {
+		log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(*token, signOptions.PublicKey))
+	}
 	log.Info().Msgf("JWE Serialized |-\n%s", ioutil.PrintText("JWE", tokenEncrypted, color.BgCyan, color.FgWhite, color.Bold))
 
-	if len(*outFile) > 0 {
-		ioutil.WriteOutput(*outFile, tokenEncrypted)
-	}
+	writeResult(tokenEncrypted)
 
 	log.Info().Msg("DONE 😀")
 
@@ -159,33 +579,30 @@ func encrypt() {
 
 func sign() {
 
-	if len(*sigKeyPath) == 0 {
-		log.Fatal().Msg("Missing parameter: -sigKey")
+	if !hasSignKey(true) {
+		log.Fatal().Msg("Missing parameter: -sig or -sig-secret")
 	}
-	if len(*inFile) == 0 {
-		log.Fatal().Msg("Missing parameter: -in")
+	if len(*inFile) == 0 && !hasClaimFlags() {
+		log.Fatal().Msg("Missing parameter: -in or -claim")
 	}
 
 	log.Info().Msg("Start signing ...")
 
-	input := ioutil.LoadInputStr(*inFile)
+	input := loadClaims()
 
-	sigKeyBytes := ioutil.LoadInput(*sigKeyPath)
-	sigPrivateKey, sigPublicKey, err := key.LoadKeyPair(sigKeyBytes, true)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("Error loading sign private key %s", *sigKeyPath)
-	}
+	sigPrivateKey, sigPublicKey := loadSignKey(true)
 	log.Info().Msg("Sign Private Key Loaded")
 
 	signOptions := createSignOptions(sigPrivateKey, sigPublicKey)
 
-	serialized, token := crypto.Sign(input, signOptions)
-
-	if len(*outFile) > 0 {
-		ioutil.WriteOutput(*outFile, serialized)
+	serialized, token, err := crypto.Sign(input, signOptions)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error signing token")
 	}
 
-	log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(token, signOptions.PublicKey))
+	writeResult(serialized)
+
+	log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(*token, signOptions.PublicKey))
 	log.Info().Msgf("JWT Serialized |-\n%s", ioutil.PrintText("JWT", serialized, color.BgCyan, color.FgWhite, color.Bold))
 
 	log.Info().Msg("DONE 😀")
@@ -194,29 +611,24 @@ func sign() {
 
 func verify() {
 
-	if len(*sigKeyPath) == 0 {
-		log.Fatal().Msg("Missing parameter: -sigKey")
+	if !hasSignKey(false) {
+		log.Fatal().Msg("Missing parameter: -sig, -sig-secret, -issuer or -x5c")
 	}
-	if len(*inFile) == 0 {
-		log.Fatal().Msg("Missing parameter: -in")
-	}
-
 	log.Info().Msg("Start verifying ...")
 
-	input := ioutil.LoadInputStr(*inFile)
+	input := loadTokenInput()
 
-	sigKeyBytes := ioutil.LoadInput(*sigKeyPath)
-	sigPublicKey, err := key.LoadPublicKey(sigKeyBytes, true)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("Error loading sign public key %v", *sigKeyPath)
-	}
+	_, sigPublicKey := loadSignKey(false)
 	log.Info().Msg("Sign Public Key Loaded")
 
 	signOptions := createSignOptions(nil, sigPublicKey)
-	token := crypto.Verify(input, signOptions)
-
-	log.Info().Msgf("JWT Serialized |-\n%s", ioutil.PrintText("JWT", token.Raw, color.BgCyan, color.FgWhite, color.Bold))
-	log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(token, signOptions.PublicKey))
+	result, err := crypto.Verify(input, signOptions)
+	if result != nil {
+		log.Info().Msgf("JWT Serialized |-\n%s", ioutil.PrintText("JWT", result.Token.Raw, color.BgCyan, color.FgWhite, color.Bold))
+		log.Info().Msgf("JWT Parsed |-\n%s", ioutil.PrintJWT(*result.Token, signOptions.PublicKey))
+	}
+	checkVerifyResult(result, err, true)
+	writeResult(ioutil.PrettyJSON(result.Token.Claims))
 
 	log.Info().Msg("DONE 😀")
 